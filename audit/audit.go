@@ -0,0 +1,261 @@
+/*
+The audit package keeps a permanent record of the changes people make to the
+skilldrill model - who made each change, when, what it was, and whether it
+succeeded - so that admins can find out how the model came to be as it is. The
+record is kept in weekly log files, one JSON Entry per line, which are never
+compacted or pruned (unlike the Store's journal). The Log can be queried by
+person, skill and time range.
+*/
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// These constants define how the Log names its files.
+const (
+	filePrefix = "audit-"
+	fileSuffix = ".log"
+)
+
+/*
+The Entry type is the record of one attempt to change the model. The Op and
+Args are the operation and its parameters (the Args are the JSON form of the
+persist.Command). The Actor is the person who made the change, Person is the
+person the change was about (if any), and Skills are the Uids of the skills it
+involved. The Error is empty when the change succeeded, and otherwise is the
+error message (which for errors from the model is the error constant).
+*/
+type Entry struct {
+	Time   time.Time       `json:"time"`
+	Actor  string          `json:"actor"`
+	Op     string          `json:"op"`
+	Args   json.RawMessage `json:"args,omitempty"`
+	Person string          `json:"person,omitempty"`
+	Skills []int           `json:"skills,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+/*
+The Filter type says which entries a query wants. The zero value of each field
+matches every entry: a Person matches entries that they made or that were about
+them; a SkillId matches entries that involved the skill; and From and To limit
+the entries to those made in that range of times (including From, but not To).
+*/
+type Filter struct {
+	Person  string
+	SkillId int
+	From    time.Time
+	To      time.Time
+}
+
+/*
+The Log type appends entries to the log file of the week they were recorded
+in, starting a new file when a new week begins. Weeks are ISO weeks in UTC,
+so the files are named like audit-2015-W23.log. A Log is safe for concurrent
+use.
+*/
+type Log struct {
+	dir   string
+	mutex sync.Mutex
+	file  *os.File
+	week  string // that the file is for
+	now   func() time.Time
+}
+
+/*
+The function NewLog() is a (compulsory) constructor for a Log that keeps its
+files in the given directory. The directory is created if it does not exist
+already.
+*/
+func NewLog(dir string) (log *Log, err error) {
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	return &Log{dir: dir, now: time.Now}, nil
+}
+
+/*
+The method Record() adds the given entry to the log, with the time now (unless
+the entry has a time already).
+*/
+func (log *Log) Record(entry Entry) (err error) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if entry.Time.IsZero() {
+		entry.Time = log.now()
+	}
+	entry.Time = entry.Time.UTC()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err = log.openWeek(weekOf(entry.Time)); err != nil {
+		return
+	}
+	_, err = log.file.Write(append(line, '\n'))
+	return
+}
+
+/*
+The method Query() provides the entries that the given filter matches, oldest
+first. Only the files for the weeks that the filter's time range covers are
+read. Lines that cannot be decoded (such as one left incomplete by a crash) are
+skipped.
+*/
+func (log *Log) Query(filter Filter) (entries []Entry, err error) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	entries = []Entry{}
+	weeks, err := log.weeks()
+	if err != nil {
+		return
+	}
+	for _, week := range weeks {
+		if !filter.From.IsZero() && week < weekOf(filter.From.UTC()) ||
+			!filter.To.IsZero() && week > weekOf(filter.To.UTC()) {
+			continue
+		}
+		if err = log.readWeek(week, filter, &entries); err != nil {
+			return
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return
+}
+
+// The method Close() releases the current log file.
+func (log *Log) Close() (err error) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	if log.file != nil {
+		err = log.file.Close()
+		log.file = nil
+	}
+	return
+}
+
+/*
+The method Matches() reports whether the given filter matches the entry. See
+Filter.
+*/
+func (filter *Filter) Matches(entry *Entry) bool {
+	if filter.Person != "" && filter.Person != entry.Actor &&
+		filter.Person != entry.Person {
+		return false
+	}
+	if !filter.From.IsZero() && entry.Time.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && !entry.Time.Before(filter.To) {
+		return false
+	}
+	if filter.SkillId == 0 {
+		return true
+	}
+	for _, skillId := range entry.Skills {
+		if skillId == filter.SkillId {
+			return true
+		}
+	}
+	return false
+}
+
+//----------------------------------------------------------------------------
+// Module Private Methods
+//----------------------------------------------------------------------------
+
+/*
+The method openWeek() makes sure that the open file is the one for the given
+week. When the file ends with an incomplete line (left by a crash), the line is
+ended, so that the next entry is not spoiled by it.
+*/
+func (log *Log) openWeek(week string) (err error) {
+	if log.file != nil && log.week == week {
+		return
+	}
+	if log.file != nil {
+		log.file.Close()
+		log.file = nil
+	}
+	file, err := os.OpenFile(log.weekFile(week),
+		os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	stat, err := file.Stat()
+	if err == nil && stat.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err = file.ReadAt(last, stat.Size()-1); err == nil &&
+			last[0] != '\n' {
+			_, err = file.Write([]byte("\n"))
+		}
+	}
+	if err != nil {
+		file.Close()
+		return
+	}
+	log.file = file
+	log.week = week
+	return
+}
+
+// The method readWeek() appends the entries in the given week's file that the
+// filter matches, to the given entries.
+func (log *Log) readWeek(week string, filter Filter, entries *[]Entry) (
+	err error) {
+	file, err := os.Open(log.weekFile(week))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		entry := Entry{}
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		if filter.Matches(&entry) {
+			*entries = append(*entries, entry)
+		}
+	}
+	return scanner.Err()
+}
+
+// The method weeks() provides the weeks that the directory has files for, in
+// ascending order.
+func (log *Log) weeks() (weeks []string, err error) {
+	paths, err := filepath.Glob(filepath.Join(log.dir,
+		filePrefix+"*"+fileSuffix))
+	if err != nil {
+		return
+	}
+	weeks = []string{}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		weeks = append(weeks, name[len(filePrefix):len(name)-len(fileSuffix)])
+	}
+	sort.Strings(weeks)
+	return
+}
+
+func (log *Log) weekFile(week string) string {
+	return filepath.Join(log.dir, filePrefix+week+fileSuffix)
+}
+
+// The function weekOf() provides the name of the ISO week that the given time
+// is in, in the form 2015-W23 - which sorts in time order.
+func weekOf(when time.Time) string {
+	year, week := when.ISOWeek()
+	return fmt.Sprintf("%04d-W%02d", year, week)
+}
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"github.com/peterhoward42/skilldrill/util/testutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordAndQuery(t *testing.T) {
+	dir := t.TempDir()
+	log, err := NewLog(dir)
+	testutil.AssertNilErr(t, err, "New log")
+	defer log.Close()
+	// A Saturday, so that the entries a day apart span two weeks.
+	start := time.Date(2015, 6, 6, 12, 0, 0, 0, time.UTC)
+	clock := start
+	log.now = func() time.Time { return clock }
+	entries := []Entry{
+		{Actor: "fred.bloggs", Op: "AddSkill", Skills: []int{2, 1}},
+		{Actor: "john.smith", Op: "GivePersonSkill", Person: "john.smith",
+			Skills: []int{2}},
+		{Actor: "fred.bloggs", Op: "GrantAdmin", Person: "john.smith",
+			Error: "Permission denied."},
+		{Actor: "john.smith", Op: "RemoveSkill", Skills: []int{3}},
+	}
+	for _, entry := range entries {
+		err = log.Record(entry)
+		testutil.AssertNilErr(t, err, "Record")
+		clock = clock.Add(24 * time.Hour)
+	}
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	testutil.AssertEqInt(t, len(names), 2, "Weekly files")
+	_, err = os.Stat(filepath.Join(dir, "audit-2015-W23.log"))
+	testutil.AssertNilErr(t, err, "File named for its week")
+
+	found, err := log.Query(Filter{})
+	testutil.AssertNilErr(t, err, "Query")
+	testutil.AssertEqInt(t, len(found), 4, "Query everything")
+	testutil.AssertEqString(t, found[2].Error, "Permission denied.",
+		"Outcome recorded")
+	testutil.AssertTrue(t, found[3].Time.Equal(start.Add(72*time.Hour)),
+		"Time recorded")
+
+	found, _ = log.Query(Filter{Person: "john.smith"})
+	testutil.AssertEqInt(t, len(found), 3, "Query by person")
+	found, _ = log.Query(Filter{SkillId: 2})
+	testutil.AssertEqInt(t, len(found), 2, "Query by skill")
+	found, _ = log.Query(Filter{From: start.Add(24 * time.Hour),
+		To: start.Add(72 * time.Hour)})
+	testutil.AssertEqInt(t, len(found), 2, "Query by time")
+	testutil.AssertEqString(t, found[0].Op, "GivePersonSkill",
+		"Query by time")
+	found, _ = log.Query(Filter{Person: "fred.bloggs",
+		From: start.Add(48 * time.Hour)})
+	testutil.AssertEqInt(t, len(found), 1, "Query by person and time")
+}
+
+func TestIncompleteLineSkipped(t *testing.T) {
+	dir := t.TempDir()
+	log, _ := NewLog(dir)
+	log.Record(Entry{Actor: "fred.bloggs", Op: "AddPerson"})
+	log.Close()
+	file, _ := os.OpenFile(log.weekFile(weekOf(time.Now().UTC())),
+		os.O_APPEND|os.O_WRONLY, 0)
+	file.WriteString(`{"actor":"fre`)
+	file.Close()
+
+	log, _ = NewLog(dir)
+	defer log.Close()
+	log.Record(Entry{Actor: "john.smith", Op: "AddPerson"})
+	found, err := log.Query(Filter{})
+	testutil.AssertNilErr(t, err, "Query")
+	testutil.AssertEqInt(t, len(found), 2, "Incomplete line skipped")
+	testutil.AssertEqString(t, found[1].Actor, "john.smith",
+		"Entry after incomplete line")
+}
@@ -0,0 +1,305 @@
+/*
+The auth package authenticates people by email, without passwords. A person
+asks for a login link, which is emailed to them. The link carries a signed,
+single-use token that expires after a short time. Following the link starts a
+session, in the form of a signed, long-lived cookie value - so that people are
+not asked to log in again on that device. Sessions can be ended (revoked) by
+logging out.
+*/
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// These constants provide a set of human-readable error message strings, with
+// machine-readable names.
+const (
+	TokenInvalid   = "Login link is not valid."
+	TokenExpired   = "Login link has expired."
+	TokenUsed      = "Login link has already been used."
+	SessionInvalid = "Not logged in."
+	SessionRevoked = "Session has been logged out."
+)
+
+// These constants are the default lifetimes of login tokens and sessions.
+const (
+	DefaultTokenLifetime   = 24 * time.Hour
+	DefaultSessionLifetime = 5 * 365 * 24 * time.Hour
+)
+
+// These constants name the files the Authenticator keeps in its directory.
+const (
+	keyFileName             = "auth.key"
+	usedTokensFileName      = "auth-used-tokens"
+	revokedSessionsFileName = "auth-revoked-sessions"
+)
+
+// These constants distinguish the kinds of signed value.
+const (
+	loginKind   = "login"
+	sessionKind = "session"
+)
+
+/*
+The Authenticator type issues and checks login tokens and session values. The
+secret signing key, the record of used tokens, and the record of revoked
+sessions are kept in files in the directory given to the constructor, so that
+they survive a restart. It is safe for concurrent use.
+*/
+type Authenticator struct {
+	mutex           sync.Mutex
+	key             []byte
+	usedTokens      *idList
+	revokedSessions *idList
+	TokenLifetime   time.Duration
+	SessionLifetime time.Duration
+	now             func() time.Time
+}
+
+/*
+The signedValue type is what login tokens and session values contain before
+they are encoded and signed.
+*/
+type signedValue struct {
+	Kind    string `json:"kind"`
+	Email   string `json:"email"`
+	Id      string `json:"id"`
+	Expires int64  `json:"expires"`
+}
+
+/*
+The function NewAuthenticator() is a (compulsory) constructor for an
+Authenticator that keeps its files in the given directory. A signing key is
+generated the first time it is used with a directory.
+*/
+func NewAuthenticator(dir string) (auth *Authenticator, err error) {
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	auth = &Authenticator{
+		TokenLifetime:   DefaultTokenLifetime,
+		SessionLifetime: DefaultSessionLifetime,
+		now:             time.Now,
+	}
+	if auth.key, err = loadOrCreateKey(filepath.Join(dir,
+		keyFileName)); err != nil {
+		return nil, err
+	}
+	now := auth.now()
+	if auth.usedTokens, err = openIdList(filepath.Join(dir,
+		usedTokensFileName), now); err != nil {
+		return nil, err
+	}
+	if auth.revokedSessions, err = openIdList(filepath.Join(dir,
+		revokedSessionsFileName), now); err != nil {
+		return nil, err
+	}
+	return
+}
+
+//----------------------------------------------------------------------------
+// Login tokens
+//----------------------------------------------------------------------------
+
+// The method NewLoginToken() issues a login token for the given email.
+func (auth *Authenticator) NewLoginToken(email string) (token string,
+	err error) {
+	return auth.issue(loginKind, email, auth.TokenLifetime)
+}
+
+/*
+The method CheckLoginToken() checks the given login token, and returns the
+email it was issued for, without redeeming it - so that it can be checked
+before the person has confirmed that they want to log in. Errors:
+TokenInvalid, TokenExpired, TokenUsed.
+*/
+func (auth *Authenticator) CheckLoginToken(token string) (email string,
+	err error) {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+	value, err := auth.checkLoginToken(token)
+	if err != nil {
+		return
+	}
+	return value.Email, nil
+}
+
+/*
+The method RedeemLoginToken() checks the given login token, and returns the
+email it was issued for. A token can only be redeemed once. Errors:
+TokenInvalid, TokenExpired, TokenUsed.
+*/
+func (auth *Authenticator) RedeemLoginToken(token string) (email string,
+	err error) {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+	value, err := auth.checkLoginToken(token)
+	if err != nil {
+		return
+	}
+	if err = auth.usedTokens.add(value.Id,
+		time.Unix(value.Expires, 0)); err != nil {
+		return
+	}
+	return value.Email, nil
+}
+
+//----------------------------------------------------------------------------
+// Sessions
+//----------------------------------------------------------------------------
+
+// The method NewSession() starts a session for the given email, and returns
+// the value to put in the session cookie.
+func (auth *Authenticator) NewSession(email string) (session string,
+	err error) {
+	return auth.issue(sessionKind, email, auth.SessionLifetime)
+}
+
+/*
+The method SessionPerson() checks the given session cookie value and returns
+the email of the person it belongs to. Errors: SessionInvalid, SessionRevoked.
+*/
+func (auth *Authenticator) SessionPerson(session string) (email string,
+	err error) {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+	value, ok := auth.verify(session, sessionKind)
+	if !ok || auth.now().After(time.Unix(value.Expires, 0)) {
+		return "", errors.New(SessionInvalid)
+	}
+	if auth.revokedSessions.contains(value.Id) {
+		return "", errors.New(SessionRevoked)
+	}
+	return value.Email, nil
+}
+
+/*
+The method EndSession() revokes the given session, so that its cookie value is
+no longer accepted - even if a copy of it has been kept. Errors:
+SessionInvalid.
+*/
+func (auth *Authenticator) EndSession(session string) (err error) {
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+	value, ok := auth.verify(session, sessionKind)
+	if !ok {
+		return errors.New(SessionInvalid)
+	}
+	return auth.revokedSessions.add(value.Id, time.Unix(value.Expires, 0))
+}
+
+//----------------------------------------------------------------------------
+// Module Private Methods
+//----------------------------------------------------------------------------
+
+// The method checkLoginToken() is the implementation of CheckLoginToken(), for
+// use when the lock is already held.
+func (auth *Authenticator) checkLoginToken(token string) (
+	value *signedValue, err error) {
+	value, ok := auth.verify(token, loginKind)
+	if !ok {
+		return nil, errors.New(TokenInvalid)
+	}
+	if auth.now().After(time.Unix(value.Expires, 0)) {
+		return nil, errors.New(TokenExpired)
+	}
+	if auth.usedTokens.contains(value.Id) {
+		return nil, errors.New(TokenUsed)
+	}
+	return
+}
+
+/*
+The method issue() makes a signed value of the given kind for the given
+email, with a random unique id. The result takes the form of the encoded value
+and its encoded signature, separated by a dot.
+*/
+func (auth *Authenticator) issue(kind string, email string,
+	lifetime time.Duration) (signed string, err error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return
+	}
+	value := &signedValue{
+		Kind:    kind,
+		Email:   email,
+		Id:      id,
+		Expires: auth.now().Add(lifetime).Unix(),
+	}
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + auth.sign(encoded), nil
+}
+
+// The method verify() checks the signature and kind of the given signed
+// value, and decodes it.
+func (auth *Authenticator) verify(signed string, kind string) (
+	value *signedValue, ok bool) {
+	parts := strings.Split(signed, ".")
+	if len(parts) != 2 {
+		return nil, false
+	}
+	if hmac.Equal([]byte(auth.sign(parts[0])), []byte(parts[1])) == false {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, false
+	}
+	value = &signedValue{}
+	if err = json.Unmarshal(payload, value); err != nil || value.Kind != kind {
+		return nil, false
+	}
+	return value, true
+}
+
+func (auth *Authenticator) sign(encoded string) string {
+	mac := hmac.New(sha256.New, auth.key)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// The function loadOrCreateKey() reads the signing key from the given file,
+// creating the file with a new random key if it does not exist.
+func loadOrCreateKey(path string) (key []byte, err error) {
+	encoded, err := os.ReadFile(path)
+	if err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(encoded)))
+	}
+	if !os.IsNotExist(err) {
+		return
+	}
+	newKey, err := randomHex(32)
+	if err != nil {
+		return
+	}
+	if err = os.WriteFile(path, []byte(newKey+"\n"), 0600); err != nil {
+		return
+	}
+	return hex.DecodeString(newKey)
+}
+
+// The function randomHex() provides the given number of random bytes, encoded
+// as hex.
+func randomHex(numBytes int) (string, error) {
+	random := make([]byte, numBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
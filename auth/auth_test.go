@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"github.com/peterhoward42/skilldrill/util/testutil"
+	"testing"
+	"time"
+)
+
+func TestLoginToken(t *testing.T) {
+	auth, err := NewAuthenticator(t.TempDir())
+	testutil.AssertNilErr(t, err, "New authenticator")
+	token, err := auth.NewLoginToken("fred.bloggs")
+	testutil.AssertNilErr(t, err, "New login token")
+
+	// Checking a token does not use it up.
+	email, err := auth.CheckLoginToken(token)
+	testutil.AssertNilErr(t, err, "Check login token")
+	testutil.AssertEqString(t, email, "fred.bloggs", "Check login token")
+
+	email, err = auth.RedeemLoginToken(token)
+	testutil.AssertNilErr(t, err, "Redeem login token")
+	testutil.AssertEqString(t, email, "fred.bloggs", "Redeem login token")
+
+	_, err = auth.RedeemLoginToken(token)
+	testutil.AssertErrGenerated(t, err, TokenUsed, "Redeem twice")
+	_, err = auth.CheckLoginToken(token)
+	testutil.AssertErrGenerated(t, err, TokenUsed, "Check after redeeming")
+}
+
+func TestLoginTokenErrors(t *testing.T) {
+	auth, _ := NewAuthenticator(t.TempDir())
+	token, _ := auth.NewLoginToken("fred.bloggs")
+
+	_, err := auth.RedeemLoginToken("rubbish")
+	testutil.AssertErrGenerated(t, err, TokenInvalid, "Rubbish token")
+	_, err = auth.RedeemLoginToken("x" + token)
+	testutil.AssertErrGenerated(t, err, TokenInvalid, "Tampered token")
+
+	// A session value must not be accepted as a login token.
+	session, _ := auth.NewSession("fred.bloggs")
+	_, err = auth.RedeemLoginToken(session)
+	testutil.AssertErrGenerated(t, err, TokenInvalid, "Session as token")
+
+	// Nor a token signed with a different key.
+	other, _ := NewAuthenticator(t.TempDir())
+	_, err = other.RedeemLoginToken(token)
+	testutil.AssertErrGenerated(t, err, TokenInvalid, "Other key")
+
+	auth.now = func() time.Time {
+		return time.Now().Add(DefaultTokenLifetime + time.Minute)
+	}
+	_, err = auth.RedeemLoginToken(token)
+	testutil.AssertErrGenerated(t, err, TokenExpired, "Expired token")
+}
+
+func TestUsedTokensSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	auth, _ := NewAuthenticator(dir)
+	token, _ := auth.NewLoginToken("fred.bloggs")
+	_, err := auth.RedeemLoginToken(token)
+	testutil.AssertNilErr(t, err, "Redeem login token")
+
+	auth, _ = NewAuthenticator(dir)
+	_, err = auth.RedeemLoginToken(token)
+	testutil.AssertErrGenerated(t, err, TokenUsed, "Redeem after restart")
+}
+
+func TestSessions(t *testing.T) {
+	dir := t.TempDir()
+	auth, _ := NewAuthenticator(dir)
+	session, err := auth.NewSession("fred.bloggs")
+	testutil.AssertNilErr(t, err, "New session")
+	other, _ := auth.NewSession("fred.bloggs")
+
+	email, err := auth.SessionPerson(session)
+	testutil.AssertNilErr(t, err, "Session person")
+	testutil.AssertEqString(t, email, "fred.bloggs", "Session person")
+
+	_, err = auth.SessionPerson("rubbish")
+	testutil.AssertErrGenerated(t, err, SessionInvalid, "Rubbish session")
+
+	err = auth.EndSession(session)
+	testutil.AssertNilErr(t, err, "End session")
+	_, err = auth.SessionPerson(session)
+	testutil.AssertErrGenerated(t, err, SessionRevoked, "Ended session")
+
+	// The revocation must survive a restart, and leave other sessions alone.
+	auth, _ = NewAuthenticator(dir)
+	_, err = auth.SessionPerson(session)
+	testutil.AssertErrGenerated(t, err, SessionRevoked, "After restart")
+	_, err = auth.SessionPerson(other)
+	testutil.AssertNilErr(t, err, "Other session after restart")
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+)
+
+/*
+The idList type is a set of ids, each with an expiry time, that is backed by an
+append-only file with one "id expiry" line per entry. Entries are only needed
+until they expire, so expired entries are dropped (and the file rewritten)
+when the list is opened. It is not safe for concurrent use.
+*/
+type idList struct {
+	path    string
+	expires map[string]time.Time
+}
+
+// The function openIdList() loads the list from the given file, which need not
+// exist yet. Entries that have expired at the given time are discarded.
+func openIdList(path string, now time.Time) (list *idList, err error) {
+	list = &idList{path: path, expires: map[string]time.Time{}}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return list, nil
+	}
+	if err != nil {
+		return
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var id string
+		var expires int64
+		if _, scanErr := fmt.Sscanf(scanner.Text(), "%s %d", &id,
+			&expires); scanErr != nil {
+			continue // An incomplete last line, from a crash.
+		}
+		if now.Before(time.Unix(expires, 0)) {
+			list.expires[id] = time.Unix(expires, 0)
+		}
+	}
+	file.Close()
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	return list, list.rewrite()
+}
+
+func (list *idList) contains(id string) bool {
+	_, ok := list.expires[id]
+	return ok
+}
+
+// The method add() adds the given id to the list, and to its file.
+func (list *idList) add(id string, expires time.Time) (err error) {
+	file, err := os.OpenFile(list.path,
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(file, "%s %d\n", id, expires.Unix())
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		list.expires[id] = expires
+	}
+	return
+}
+
+// The method rewrite() replaces the file with the list's current entries.
+func (list *idList) rewrite() (err error) {
+	tempPath := list.path + ".tmp"
+	file, err := os.Create(tempPath)
+	if err != nil {
+		return
+	}
+	writer := bufio.NewWriter(file)
+	for id, expires := range list.expires {
+		fmt.Fprintf(writer, "%s %d\n", id, expires.Unix())
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	return os.Rename(tempPath, list.path)
+}
@@ -0,0 +1,153 @@
+/*
+The mail package provides a Mailer interface for sending email, with two
+implementations. The SMTPMailer sends real email through an SMTP server, while
+the MaildirMailer simply writes each message into a local maildir directory -
+which is useful for testing and for running the server without a mail server.
+*/
+package mail
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The IllegalHeader error is generated when the recipient or subject of a
+// message would break its headers.
+const IllegalHeader = "Email address or subject contains a line break."
+
+// The Mailer interface is satisfied by anything that can send a plain text
+// email message.
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+//----------------------------------------------------------------------------
+// SMTPMailer
+//----------------------------------------------------------------------------
+
+/*
+The SMTPMailer type sends email using the SMTP server at the given address
+(host:port), from the given sender address. Auth may be left nil when the
+server does not require authentication.
+*/
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// The method Send() satisfies the Mailer interface.
+func (mailer *SMTPMailer) Send(to string, subject string, body string) error {
+	message, err := formatMessage(mailer.From, to, subject, body)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(mailer.Addr, mailer.Auth, mailer.From, []string{to},
+		message)
+}
+
+//----------------------------------------------------------------------------
+// MaildirMailer
+//----------------------------------------------------------------------------
+
+/*
+The MaildirMailer type delivers each message as a file into the "new"
+sub-directory of the maildir at Dir, using the conventional maildir protocol of
+writing into "tmp" first and then renaming. The directories are created when
+required.
+*/
+type MaildirMailer struct {
+	Dir  string
+	From string
+}
+
+// The method Send() satisfies the Mailer interface.
+func (mailer *MaildirMailer) Send(to string, subject string,
+	body string) (err error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err = os.MkdirAll(filepath.Join(mailer.Dir, sub), 0700); err != nil {
+			return
+		}
+	}
+	message, err := formatMessage(mailer.From, to, subject, body)
+	if err != nil {
+		return
+	}
+	name, err := uniqueName()
+	if err != nil {
+		return
+	}
+	tmpPath := filepath.Join(mailer.Dir, "tmp", name)
+	if err = os.WriteFile(tmpPath, message, 0600); err != nil {
+		return
+	}
+	return os.Rename(tmpPath, filepath.Join(mailer.Dir, "new", name))
+}
+
+/*
+The function ReadMaildir() returns the content of every message in the "new"
+sub-directory of the given maildir. It is intended for use by tests.
+*/
+func ReadMaildir(dir string) (messages []string, err error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "new", "*"))
+	if err != nil {
+		return
+	}
+	messages = []string{}
+	for _, path := range paths {
+		var content []byte
+		if content, err = os.ReadFile(path); err != nil {
+			return
+		}
+		messages = append(messages, string(content))
+	}
+	return
+}
+
+//----------------------------------------------------------------------------
+// Module Private Functions
+//----------------------------------------------------------------------------
+
+/*
+The function formatMessage() makes an RFC 822 style message. Generates the
+IllegalHeader error when any of the header values contains a line break, which
+would let it add headers of its own (such as Bcc).
+*/
+func formatMessage(from string, to string, subject string,
+	body string) (message []byte, err error) {
+	for _, value := range []string{from, to, subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, errors.New(IllegalHeader)
+		}
+	}
+	headers := []string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	body = strings.Replace(body, "\n", "\r\n", -1)
+	message = []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + body +
+		"\r\n")
+	return
+}
+
+// The function uniqueName() makes a file name for a maildir message.
+func uniqueName() (name string, err error) {
+	random := make([]byte, 8)
+	if _, err = rand.Read(random); err != nil {
+		return
+	}
+	hostname, _ := os.Hostname()
+	name = fmt.Sprintf("%d.%s.%s", time.Now().UnixNano(),
+		hex.EncodeToString(random), hostname)
+	return
+}
@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"github.com/peterhoward42/skilldrill/util/testutil"
+	"testing"
+)
+
+func TestMaildirMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &MaildirMailer{Dir: dir, From: "skilldrill@example.com"}
+	err := mailer.Send("fred.bloggs@example.com", "Hello", "Line one\nLine two")
+	testutil.AssertNilErr(t, err, "Send")
+	err = mailer.Send("john.smith@example.com", "Hello again", "Body")
+	testutil.AssertNilErr(t, err, "Send")
+
+	messages, err := ReadMaildir(dir)
+	testutil.AssertNilErr(t, err, "Read maildir")
+	testutil.AssertEqInt(t, len(messages), 2, "Number of messages")
+	all := messages[0] + messages[1]
+	testutil.AssertStrContains(t, all, "To: fred.bloggs@example.com\r\n",
+		"Message")
+	testutil.AssertStrContains(t, all, "Subject: Hello again\r\n", "Message")
+	testutil.AssertStrContains(t, all, "\r\n\r\nLine one\r\nLine two\r\n",
+		"Message")
+
+	// Header values cannot add headers of their own.
+	err = mailer.Send("fred.bloggs@example.com", "x\r\nBcc: a@b.c", "Body")
+	testutil.AssertErrGenerated(t, err, IllegalHeader, "Subject with break")
+	err = mailer.Send("fred@example.com\nBcc: a@b.c", "Hello", "Body")
+	testutil.AssertErrGenerated(t, err, IllegalHeader, "Address with break")
+	messages, _ = ReadMaildir(dir)
+	testutil.AssertEqInt(t, len(messages), 2, "Nothing more sent")
+}
@@ -0,0 +1,914 @@
+package main
+
+import (
+	"fmt"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"github.com/peterhoward42/skilldrill/persist"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+The pickerRow type is the view model for one row of the tree shown on the
+admin pages - both as the list of skills to manage, and as the tree-picker for
+choosing a new parent category.
+*/
+type pickerRow struct {
+	Uid        int
+	Title      string
+	Indent     int // pixels
+	IsCategory bool
+	Current    bool // the skill's current parent
+}
+
+/*
+The adminPageData type is the view model for the admin home page, which lists
+the admins, and every skill in the tree for choosing one to manage.
+*/
+type adminPageData struct {
+	Person  string
+	Admins  []string
+	Rows    []pickerRow
+	Error   string
+	Undo    string
+	Redo    string
+	Dropped string
+	Back    string
+}
+
+/*
+The adminSkillPageData type is the view model for the page on which an admin
+renames, moves, merges or removes one skill. The Parents are the categories
+the skill could be moved to, and the MergeTargets are the skills it could be
+merged into. When a removal is refused, the Blockers are the people or child
+skills that prevent it, and BlockersAre says which.
+*/
+type adminSkillPageData struct {
+	Uid          int
+	Title        string
+	Breadcrumb   []string
+	IsRoot       bool
+	IsCategory   bool
+	Aliases      []string
+	Parents      []pickerRow
+	MergeTargets []pickerRow
+	SplitRows    []int // one per row of the split form
+	EditTitle    string
+	Error        string
+	Blockers     []string
+	BlockersAre  string
+}
+
+/*
+The confirmPageData type is the view model for the page that asks an admin to
+confirm a change before it is made. The Details, when given, list what the
+change will affect. The form re-posts the same fields to the same Action, with
+the addition of confirm=yes.
+*/
+type confirmPageData struct {
+	Question string
+	Details  []string
+	Action   string
+	Skill    int
+	Parent   int
+	Other    int
+	Role     string
+	Backup   string
+	Cancel   string
+}
+
+/*
+The adminHandler() function generates the admin home page.
+*/
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	email, ok := currentAdmin(w, r)
+	if !ok {
+		return
+	}
+	showAdminPage(w, email, "")
+}
+
+/*
+The adminGrantHandler() function receives the form from the admin home page
+that makes another person an admin, and redirects back to the admin page.
+*/
+func adminGrantHandler(w http.ResponseWriter, r *http.Request) {
+	adminRoleChange(w, r, persist.OpGrantAdmin)
+}
+
+// The adminRevokeHandler() function is the inverse of adminGrantHandler().
+func adminRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	adminRoleChange(w, r, persist.OpRevokeAdmin)
+}
+
+// Common implementation for adminGrantHandler() and adminRevokeHandler().
+func adminRoleChange(w http.ResponseWriter, r *http.Request, op string) {
+	if requirePost(w, r) == false {
+		return
+	}
+	email, ok := currentAdmin(w, r)
+	if !ok {
+		return
+	}
+	cmd := &persist.Command{Op: op, Actor: email,
+		Email: strings.TrimSpace(r.FormValue("email"))}
+	if err := store.Do(cmd); err != nil {
+		showAdminPage(w, email, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+/*
+The adminSkillHandler() function generates the page for managing the skill
+given by the "skill" query parameter.
+*/
+func adminSkillHandler(w http.ResponseWriter, r *http.Request) {
+	_, ok := currentAdmin(w, r)
+	if !ok {
+		return
+	}
+	skillId, ok := skillFromRequest(w, r)
+	if !ok {
+		return
+	}
+	showAdminSkillPage(w, skillId, func(data *adminSkillPageData) {})
+}
+
+/*
+The adminRenameHandler() function receives the rename form from the admin
+skill page. When the model rejects the new title, the page is shown again with
+the error alongside the title that was submitted.
+*/
+func adminRenameHandler(w http.ResponseWriter, r *http.Request) {
+	if requirePost(w, r) == false {
+		return
+	}
+	email, ok := currentAdmin(w, r)
+	if !ok {
+		return
+	}
+	skillId, ok := skillFromRequest(w, r)
+	if !ok {
+		return
+	}
+	newTitle := strings.TrimSpace(r.FormValue("title"))
+	err := store.Do(&persist.Command{Op: persist.OpSetSkillTitle,
+		Actor: email, SkillId: skillId, Title: newTitle})
+	if err != nil {
+		showAdminSkillPage(w, skillId, func(data *adminSkillPageData) {
+			data.EditTitle = newTitle
+			data.Error = err.Error()
+		})
+		return
+	}
+	http.Redirect(w, r, adminSkillUrl(skillId), http.StatusSeeOther)
+}
+
+/*
+The adminMoveHandler() function receives the tree-picker form from the admin
+skill page, which chooses a new parent category for the skill. It asks for
+confirmation first - showing what a dry-run of the move says it will affect -
+and then moves the skill (along with its children).
+*/
+func adminMoveHandler(w http.ResponseWriter, r *http.Request) {
+	if requirePost(w, r) == false {
+		return
+	}
+	email, ok := currentAdmin(w, r)
+	if !ok {
+		return
+	}
+	skillId, ok := skillFromRequest(w, r)
+	if !ok {
+		return
+	}
+	parent, err := strconv.Atoi(r.FormValue("parent"))
+	if err != nil {
+		showAdminSkillPage(w, skillId, func(data *adminSkillPageData) {
+			data.Error = "Please choose the category to move it to."
+		})
+		return
+	}
+	if r.PostFormValue("confirm") != "yes" {
+		var title, parentTitle string
+		var skills []int
+		var holders []string
+		err = store.Read(func(api *model.Api) (err error) {
+			skills, holders, err = api.PreviewReParentSkill(email, skillId,
+				parent)
+			if err != nil {
+				return
+			}
+			if title, _, _, err = api.SkillSummary(skillId); err != nil {
+				return
+			}
+			parentTitle, _, _, err = api.SkillSummary(parent)
+			return
+		})
+		if err != nil {
+			showAdminSkillPage(w, skillId, func(data *adminSkillPageData) {
+				data.Error = err.Error()
+			})
+			return
+		}
+		confirmPage.Execute(w, &confirmPageData{
+			Question: "Move \"" + title + "\", and everything in it, into \"" +
+				parentTitle + "\"?",
+			Details: []string{
+				fmt.Sprintf("%d skills will move.", len(skills)),
+				fmt.Sprintf("%d people hold them: %s", len(holders),
+					strings.Join(holders, ", ")),
+			},
+			Action: "/admin/move",
+			Skill:  skillId,
+			Parent: parent,
+			Cancel: adminSkillUrl(skillId),
+		})
+		return
+	}
+	err = store.Do(&persist.Command{Op: persist.OpReParentSkill, Actor: email,
+		SkillId: skillId, Parent: parent})
+	if err != nil {
+		showAdminSkillPage(w, skillId, func(data *adminSkillPageData) {
+			data.Error = err.Error()
+		})
+		return
+	}
+	http.Redirect(w, r, adminSkillUrl(skillId), http.StatusSeeOther)
+}
+
+/*
+The adminMergeHandler() function receives the merge form from the admin skill
+page, which chooses another skill (the "other" form value) for this one to be
+merged into. It asks for confirmation first, and then merges them.
+*/
+func adminMergeHandler(w http.ResponseWriter, r *http.Request) {
+	if requirePost(w, r) == false {
+		return
+	}
+	email, ok := currentAdmin(w, r)
+	if !ok {
+		return
+	}
+	skillId, ok := skillFromRequest(w, r)
+	if !ok {
+		return
+	}
+	keep, err := strconv.Atoi(r.FormValue("other"))
+	if err != nil {
+		showAdminSkillPage(w, skillId, func(data *adminSkillPageData) {
+			data.Error = "Please choose the skill to merge it into."
+		})
+		return
+	}
+	if r.PostFormValue("confirm") != "yes" {
+		var title, keepTitle string
+		err = store.Read(func(api *model.Api) (err error) {
+			if title, _, _, err = api.SkillSummary(skillId); err != nil {
+				return
+			}
+			keepTitle, _, _, err = api.SkillSummary(keep)
+			return
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		confirmPage.Execute(w, &confirmPageData{
+			Question: "Merge \"" + title + "\" into \"" + keepTitle +
+				"\"? Everybody who has \"" + title + "\" will have \"" +
+				keepTitle + "\" instead.",
+			Action: "/admin/merge",
+			Skill:  skillId,
+			Other:  keep,
+			Cancel: adminSkillUrl(skillId),
+		})
+		return
+	}
+	err = store.Do(&persist.Command{Op: persist.OpMergeSkills, Actor: email,
+		SkillId: keep, Other: skillId})
+	if err != nil {
+		showAdminSkillPage(w, skillId, func(data *adminSkillPageData) {
+			data.Error = err.Error()
+		})
+		return
+	}
+	http.Redirect(w, r, adminSkillUrl(keep), http.StatusSeeOther)
+}
+
+/*
+The splitPageData type is the view model for the page on which an admin
+decides what happens to the holders of a skill that is being split. Each of
+the Holders is either reassigned to one of the Children, or marked as needing
+to review the split.
+*/
+type splitPageData struct {
+	Uid      int
+	Title    string
+	Children []model.NewChild
+	Holders  []string
+	Cancel   string
+}
+
+/*
+The adminSplitHandler() function receives the split form from the admin skill
+page, which describes the new skills the skill is to be split into (as
+repeated "title" and "desc" form values, where rows without a title are
+ignored). It first shows a page for choosing what happens to each of the
+skill's holders, which is also the confirmation step, and when that is posted
+back (with paired "holder" and "assign" form values), splits the skill.
+*/
+func adminSplitHandler(w http.ResponseWriter, r *http.Request) {
+	if requirePost(w, r) == false {
+		return
+	}
+	email, ok := currentAdmin(w, r)
+	if !ok {
+		return
+	}
+	skillId, ok := skillFromRequest(w, r)
+	if !ok {
+		return
+	}
+	r.ParseForm()
+	children := []model.NewChild{}
+	descs := r.Form["desc"]
+	for idx, title := range r.Form["title"] {
+		child := model.NewChild{Title: strings.TrimSpace(title)}
+		if idx < len(descs) {
+			child.Desc = strings.TrimSpace(descs[idx])
+		}
+		if child.Title != "" {
+			children = append(children, child)
+		}
+	}
+	if len(children) == 0 {
+		showAdminSkillPage(w, skillId, func(data *adminSkillPageData) {
+			data.Error = model.NoChildren
+		})
+		return
+	}
+	if r.PostFormValue("confirm") != "yes" {
+		data := &splitPageData{Uid: skillId, Children: children,
+			Cancel: adminSkillUrl(skillId)}
+		err := store.Read(func(api *model.Api) (err error) {
+			if data.Title, _, _, err = api.SkillSummary(skillId); err != nil {
+				return
+			}
+			data.Holders, err = api.PeopleWithSkill(skillId)
+			sort.Strings(data.Holders)
+			return
+		})
+		if err != nil {
+			showAdminSkillPage(w, skillId, func(data *adminSkillPageData) {
+				data.Error = err.Error()
+			})
+			return
+		}
+		splitPage.Execute(w, data)
+		return
+	}
+	reassign := map[string]int{}
+	assigns := r.Form["assign"]
+	for idx, holder := range r.Form["holder"] {
+		if idx >= len(assigns) {
+			break
+		}
+		if childIdx, err := strconv.Atoi(assigns[idx]); err == nil {
+			reassign[holder] = childIdx
+		}
+	}
+	err := store.Do(&persist.Command{Op: persist.OpSplitSkill, Actor: email,
+		SkillId: skillId, Children: children, Reassign: reassign})
+	if err != nil {
+		showAdminSkillPage(w, skillId, func(data *adminSkillPageData) {
+			data.Error = err.Error()
+		})
+		return
+	}
+	http.Redirect(w, r, adminSkillUrl(skillId), http.StatusSeeOther)
+}
+
+/*
+The adminConvertHandler() function receives the form from the admin skill page
+that makes a category of a skill, or a skill of a category (as given by the
+"role" form value). It asks for confirmation first - listing the people who
+have the skill, since they will be asked to review it - and then changes the
+skill's role.
+*/
+func adminConvertHandler(w http.ResponseWriter, r *http.Request) {
+	if requirePost(w, r) == false {
+		return
+	}
+	email, ok := currentAdmin(w, r)
+	if !ok {
+		return
+	}
+	skillId, ok := skillFromRequest(w, r)
+	if !ok {
+		return
+	}
+	role := r.FormValue("role")
+	if r.PostFormValue("confirm") != "yes" {
+		data := &confirmPageData{Action: "/admin/convert", Skill: skillId,
+			Role: role, Cancel: adminSkillUrl(skillId)}
+		var title string
+		err := store.Read(func(api *model.Api) (err error) {
+			if title, _, _, err = api.SkillSummary(skillId); err != nil {
+				return
+			}
+			if role == model.Category {
+				data.Details, err = api.PeopleWithSkill(skillId)
+				sort.Strings(data.Details)
+			}
+			return
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data.Question = "Make a skill of \"" + title + "\"?"
+		if role == model.Category {
+			data.Question = "Make a category of \"" + title + "\"?"
+			if len(data.Details) != 0 {
+				data.Question += " These people have it, and will be asked " +
+					"to pick the skills inside it that they have:"
+			}
+		}
+		confirmPage.Execute(w, data)
+		return
+	}
+	err := store.Do(&persist.Command{Op: persist.OpSetSkillRole, Actor: email,
+		SkillId: skillId, Role: role, Review: true})
+	if err != nil {
+		showAdminSkillPage(w, skillId, func(data *adminSkillPageData) {
+			data.Error = err.Error()
+		})
+		return
+	}
+	http.Redirect(w, r, adminSkillUrl(skillId), http.StatusSeeOther)
+}
+
+/*
+The adminRemoveHandler() function receives the remove form from the admin
+skill page. It asks for confirmation first, and then removes the skill. When
+the model refuses because the skill is held, or has children, the page is
+shown again with the error and the holders or children that are in the way.
+*/
+func adminRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	if requirePost(w, r) == false {
+		return
+	}
+	email, ok := currentAdmin(w, r)
+	if !ok {
+		return
+	}
+	skillId, ok := skillFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if r.PostFormValue("confirm") != "yes" {
+		var title string
+		err := store.Read(func(api *model.Api) (err error) {
+			title, _, _, err = api.SkillSummary(skillId)
+			return
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		confirmPage.Execute(w, &confirmPageData{
+			Question: "Remove \"" + title + "\"? You can undo this for a " +
+				"while afterwards.",
+			Action: "/admin/remove",
+			Skill:  skillId,
+			Cancel: adminSkillUrl(skillId),
+		})
+		return
+	}
+	err := store.Do(&persist.Command{Op: persist.OpRemoveSkill, Actor: email,
+		SkillId: skillId})
+	if err != nil {
+		showAdminSkillPage(w, skillId, func(data *adminSkillPageData) {
+			data.Error = err.Error()
+		})
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+//----------------------------------------------------------------------------
+
+/*
+The function currentAdmin() works out which person the request comes from
+like currentPerson() does, and additionally requires them to be an admin. It
+returns false (having already written an error response) when they are not.
+*/
+func currentAdmin(w http.ResponseWriter, r *http.Request) (
+	email string, ok bool) {
+	if email, ok = currentPerson(w, r); !ok {
+		return
+	}
+	if isAdmin(email) == false {
+		http.Error(w, model.PermissionDenied, http.StatusForbidden)
+		return "", false
+	}
+	return email, true
+}
+
+// The function isAdmin() is a convenience wrapper for the Api method of the
+// same name.
+func isAdmin(email string) (admin bool) {
+	store.Read(func(api *model.Api) error {
+		admin = api.IsAdmin(email)
+		return nil
+	})
+	return
+}
+
+// The function showAdminPage() renders the admin home page, with the given
+// error message (if not empty).
+func showAdminPage(w http.ResponseWriter, email string, errMsg string) {
+	data := &adminPageData{Person: email, Error: errMsg, Back: "/admin"}
+	err := store.Read(func(api *model.Api) (err error) {
+		data.Admins = api.Admins()
+		data.Undo, data.Redo, data.Dropped, err = api.UndoState(email)
+		if err != nil {
+			return
+		}
+		data.Rows, err = buildPickerRows(api, -1, "")
+		return
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	adminPage.Execute(w, data)
+}
+
+/*
+The function showAdminSkillPage() renders the admin page for the given skill.
+The adjust function is called with the view model before it is rendered, and
+is how callers add error information. The blocking holders or children are
+filled in here, when the error is one that has them.
+*/
+func showAdminSkillPage(w http.ResponseWriter, skillId int,
+	adjust func(data *adminSkillPageData)) {
+	var data *adminSkillPageData
+	err := store.Read(func(api *model.Api) (err error) {
+		if data, err = buildAdminSkillPageData(api, skillId); err != nil {
+			return
+		}
+		adjust(data)
+		switch data.Error {
+		case model.CannotRemoveSkillHeld:
+			data.BlockersAre = "These people have the skill"
+			data.Blockers, err = api.PeopleWithSkill(skillId)
+			sort.Strings(data.Blockers)
+		case model.CannotRemoveSkillWithChildren,
+			model.CannotChangeRoleWithChildren:
+			data.BlockersAre = "These skills are inside it"
+			data.Blockers, err = childTitles(api, skillId)
+		}
+		return
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	adminSkillPage.Execute(w, data)
+}
+
+// The function buildAdminSkillPageData() assembles the view model for the
+// admin skill page.
+func buildAdminSkillPageData(api *model.Api, skillId int) (
+	data *adminSkillPageData, err error) {
+	data = &adminSkillPageData{Uid: skillId}
+	var contextAlone string
+	data.Title, _, _, contextAlone, err = api.SkillWording(skillId)
+	if err != nil {
+		return
+	}
+	if contextAlone != "" {
+		data.Breadcrumb = strings.Split(contextAlone, ">>>")
+	}
+	parent, _, err := api.SkillRelations(skillId)
+	if err != nil {
+		return
+	}
+	data.IsRoot = parent == -1
+	var role string
+	if _, role, _, err = api.SkillSummary(skillId); err != nil {
+		return
+	}
+	data.IsCategory = role == model.Category
+	if data.Aliases, err = api.SkillAliases(skillId); err != nil {
+		return
+	}
+	data.EditTitle = data.Title
+	data.SplitRows = make([]int, splitRows)
+	if data.Parents, err = buildPickerRows(api, skillId,
+		model.Category); err != nil {
+		return
+	}
+	if data.MergeTargets, err = buildPickerRows(api, skillId,
+		role); err != nil {
+		return
+	}
+	for idx := range data.Parents {
+		data.Parents[idx].Current = data.Parents[idx].Uid == parent
+	}
+	return
+}
+
+/*
+The function buildPickerRows() assembles the rows of the whole tree. When a
+skill to move is given (i.e. not -1), the skill itself and everything inside
+it are left out, since it cannot be moved (or merged) into them. When a role
+is given (i.e. not empty), only the skills with that role are included.
+*/
+func buildPickerRows(api *model.Api, toMove int, role string) (
+	rows []pickerRow, err error) {
+	skills, depths := api.EnumerateWholeTree()
+	rows = []pickerRow{}
+	excludeBelow := -1 // depth of toMove, while inside its sub-tree
+	for idx, skillId := range skills {
+		if excludeBelow != -1 && depths[idx] > excludeBelow {
+			continue
+		}
+		excludeBelow = -1
+		if skillId == toMove {
+			excludeBelow = depths[idx]
+			continue
+		}
+		row := pickerRow{Uid: skillId, Indent: depths[idx] * indentPerDepth}
+		var rowRole string
+		if row.Title, rowRole, _, err = api.SkillSummary(skillId); err != nil {
+			return
+		}
+		row.IsCategory = rowRole == model.Category
+		if role != "" && rowRole != role {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return
+}
+
+// The function childTitles() provides the titles of the given skill's
+// children.
+func childTitles(api *model.Api, skillId int) (titles []string, err error) {
+	_, children, err := api.SkillRelations(skillId)
+	if err != nil {
+		return
+	}
+	titles = []string{}
+	for _, child := range children {
+		var title string
+		if title, _, _, err = api.SkillSummary(child); err != nil {
+			return
+		}
+		titles = append(titles, title)
+	}
+	return
+}
+
+// The splitRows constant is the number of new skills that the split form
+// has room for.
+const splitRows = 5
+
+// The function adminSkillUrl() provides the url of the admin page for the
+// given skill.
+func adminSkillUrl(skillId int) string {
+	return "/admin/skill?skill=" + strconv.Itoa(skillId)
+}
+
+//----------------------------------------------------------------------------
+
+var adminPage = newPage("admin", adminPageSource)
+
+var adminPageSource = `
+{{define "content"}}
+<p><a href="/">Back to skills</a></p>
+<h1>Admin</h1>
+{{if .Error}}
+<div class="alert alert-danger">{{.Error}}</div>
+{{end}}
+<p><a href="/admin/backups">Backups</a> | <a href="/admin/audit">Audit log</a></p>
+{{template "undo" .}}
+
+<h3>Skills</h3>
+<p>Choose a skill to rename, move or remove it.</p>
+<table class="table table-condensed">
+   {{range .Rows}}
+   <tr>
+      <td style="padding-left: {{.Indent}}px">
+         {{if .IsCategory}}
+         <span class="glyphicon glyphicon-folder-open"></span>
+         {{else}}
+         <span class="glyphicon glyphicon-file"></span>
+         {{end}}
+         <a href="/admin/skill?skill={{.Uid}}">{{.Title}}</a>
+      </td>
+   </tr>
+   {{end}}
+</table>
+
+<h3>Admins</h3>
+<table class="table table-condensed">
+   {{range .Admins}}
+   <tr>
+      <td>{{.}}</td>
+      <td>
+         <form method="post" action="/admin/revoke" class="form-inline">
+            <input type="hidden" name="email" value="{{.}}" />
+            <button type="submit" class="btn btn-link">Revoke</button>
+         </form>
+      </td>
+   </tr>
+   {{end}}
+</table>
+<form method="post" action="/admin/grant" class="form-inline">
+   <div class="form-group">
+      <label for="email">Make an admin of</label>
+      <input type="text" class="form-control" id="email" name="email" />
+   </div>
+   <button type="submit" class="btn btn-default">Add admin</button>
+</form>
+{{end}}
+`
+
+var adminSkillPage = newPage("adminskill", adminSkillPageSource)
+
+var adminSkillPageSource = `
+{{define "content"}}
+<p><a href="/admin">Back to admin</a></p>
+{{if .Breadcrumb}}
+<ol class="breadcrumb">
+   {{range .Breadcrumb}}<li>{{.}}</li>{{end}}
+</ol>
+{{end}}
+<h1>{{.Title}}</h1>
+{{if .Aliases}}
+<p class="text-muted">Also known as: {{range $i, $a := .Aliases}}{{if $i}}, {{end}}{{$a}}{{end}}</p>
+{{end}}
+{{if .Error}}
+<div class="alert alert-danger">
+   {{.Error}}
+   {{if .Blockers}}
+   {{.BlockersAre}}:
+   <ul>{{range .Blockers}}<li>{{.}}</li>{{end}}</ul>
+   {{end}}
+</div>
+{{end}}
+<p><a href="/admin/audit?skill={{.Uid}}">History of changes</a></p>
+
+<h3>Rename</h3>
+<form method="post" action="/admin/rename" class="form-inline">
+   <input type="hidden" name="skill" value="{{.Uid}}" />
+   <input type="text" class="form-control" name="title"
+      value="{{.EditTitle}}" />
+   <button type="submit" class="btn btn-default">Rename</button>
+</form>
+
+{{if not .IsRoot}}
+<h3>Move</h3>
+<form method="post" action="/admin/move">
+   <input type="hidden" name="skill" value="{{.Uid}}" />
+   {{range .Parents}}
+   <div class="radio" style="padding-left: {{.Indent}}px">
+      <label>
+         <input type="radio" name="parent" value="{{.Uid}}"
+            {{if .Current}}checked{{end}} />
+         <span class="glyphicon glyphicon-folder-open"></span>
+         {{.Title}}{{if .Current}} (where it is now){{end}}
+      </label>
+   </div>
+   {{end}}
+   <button type="submit" class="btn btn-default">Move</button>
+</form>
+
+{{if not .IsCategory}}
+<h3>Split</h3>
+<p>Split this skill into finer-grained skills. It will become a category, with
+   the new skills inside it.</p>
+<form method="post" action="/admin/split">
+   <input type="hidden" name="skill" value="{{.Uid}}" />
+   {{range $i := .SplitRows}}
+   <div class="form-inline form-group">
+      <input type="text" class="form-control" name="title"
+         placeholder="Title" />
+      <input type="text" class="form-control" name="desc"
+         placeholder="Description" size="50" />
+   </div>
+   {{end}}
+   <button type="submit" class="btn btn-default">Split</button>
+</form>
+{{end}}
+
+<h3>Merge</h3>
+<p>Merge this {{if .IsCategory}}category{{else}}skill{{end}} into another one
+   that means the same thing.</p>
+<form method="post" action="/admin/merge" class="form-inline">
+   <input type="hidden" name="skill" value="{{.Uid}}" />
+   <select class="form-control" name="other">
+      {{range .MergeTargets}}
+      <option value="{{.Uid}}">{{.Title}}</option>
+      {{end}}
+   </select>
+   <button type="submit" class="btn btn-default">Merge</button>
+</form>
+
+{{if .IsCategory}}
+<h3>Make a skill</h3>
+<p>Make this category a skill that people can have. It must be empty.</p>
+<form method="post" action="/admin/convert">
+   <input type="hidden" name="skill" value="{{.Uid}}" />
+   <input type="hidden" name="role" value="SKL" />
+   <button type="submit" class="btn btn-default">Make a skill</button>
+</form>
+{{else}}
+<h3>Make a category</h3>
+<p>Make this skill a category, so that skills can be added inside it.</p>
+<form method="post" action="/admin/convert">
+   <input type="hidden" name="skill" value="{{.Uid}}" />
+   <input type="hidden" name="role" value="CAT" />
+   <button type="submit" class="btn btn-default">Make a category</button>
+</form>
+{{end}}
+
+<h3>Remove</h3>
+<form method="post" action="/admin/remove">
+   <input type="hidden" name="skill" value="{{.Uid}}" />
+   <button type="submit" class="btn btn-danger">Remove</button>
+</form>
+{{end}}
+{{end}}
+`
+
+var splitPage = newPage("split", splitPageSource)
+
+var splitPageSource = `
+{{define "content"}}
+<h1>Split "{{.Title}}"</h1>
+<p>It will become a category containing:</p>
+<ul>
+   {{range .Children}}<li><strong>{{.Title}}</strong> {{.Desc}}</li>{{end}}
+</ul>
+<form method="post" action="/admin/split">
+   <input type="hidden" name="skill" value="{{.Uid}}" />
+   {{range .Children}}
+   <input type="hidden" name="title" value="{{.Title}}" />
+   <input type="hidden" name="desc" value="{{.Desc}}" />
+   {{end}}
+   {{if .Holders}}
+   <p>These people have "{{.Title}}" now. Choose the new skill each of them
+      should have, or ask them to pick for themselves.</p>
+   <table class="table table-condensed">
+      {{range .Holders}}
+      <tr>
+         <td>{{.}}</td>
+         <td>
+            <input type="hidden" name="holder" value="{{.}}" />
+            <select class="form-control" name="assign">
+               <option value="">Ask them to pick</option>
+               {{range $i, $child := $.Children}}
+               <option value="{{$i}}">{{$child.Title}}</option>
+               {{end}}
+            </select>
+         </td>
+      </tr>
+      {{end}}
+   </table>
+   {{end}}
+   <input type="hidden" name="confirm" value="yes" />
+   <button type="submit" class="btn btn-primary">Split</button>
+   <a href="{{.Cancel}}" class="btn btn-default">Cancel</a>
+</form>
+{{end}}
+`
+
+var confirmPage = newPage("confirm", confirmPageSource)
+
+var confirmPageSource = `
+{{define "content"}}
+<h1>Please confirm</h1>
+<p>{{.Question}}</p>
+{{if .Details}}
+<ul>{{range .Details}}<li>{{.}}</li>{{end}}</ul>
+{{end}}
+<form method="post" action="{{.Action}}" class="form-inline">
+   <input type="hidden" name="skill" value="{{.Skill}}" />
+   <input type="hidden" name="parent" value="{{.Parent}}" />
+   <input type="hidden" name="other" value="{{.Other}}" />
+   <input type="hidden" name="role" value="{{.Role}}" />
+   <input type="hidden" name="backup" value="{{.Backup}}" />
+   <input type="hidden" name="confirm" value="yes" />
+   <button type="submit" class="btn btn-primary">Yes</button>
+   <a href="{{.Cancel}}" class="btn btn-default">Cancel</a>
+</form>
+{{end}}
+`
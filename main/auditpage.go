@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/peterhoward42/skilldrill/audit"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The maxAuditRows is the most audit log entries that the audit page shows.
+const maxAuditRows = 500
+
+// The auditDateFormat is how dates are entered on the audit page, and
+// badAuditDate is the error when they are not.
+const (
+	auditDateFormat = "2006-01-02"
+	badAuditDate    = "Please give dates as yyyy-mm-dd."
+)
+
+/*
+The auditRow type is the view model for one entry of the audit log, on the
+audit page. The Skills are the paths of the skills the entry involved.
+*/
+type auditRow struct {
+	Time    string
+	Actor   string
+	Op      string
+	Skills  []string
+	Args    string
+	Outcome string
+	Failed  bool
+}
+
+/*
+The auditPageData type is the view model for the admin page that shows the
+audit log. The Person, Path, From and To are the filter, as entered. The Rows
+are newest first, and Truncated says when there were more than are shown.
+*/
+type auditPageData struct {
+	Person    string
+	Path      string
+	From      string
+	To        string
+	Rows      []auditRow
+	Truncated bool
+	Error     string
+}
+
+/*
+The auditHandler() function generates the page that shows the audit log,
+filtered by the "person", "path" (or "skill" Uid), "from" and "to" query
+parameters. The dates are inclusive, and any of the parameters may be empty.
+*/
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := currentAdmin(w, r); !ok {
+		return
+	}
+	data := &auditPageData{
+		Person: strings.TrimSpace(r.FormValue("person")),
+		Path:   strings.TrimSpace(r.FormValue("path")),
+		From:   strings.TrimSpace(r.FormValue("from")),
+		To:     strings.TrimSpace(r.FormValue("to")),
+	}
+	filter, err := auditFilter(data, r.FormValue("skill"))
+	if err != nil {
+		data.Error = err.Error()
+		auditPage.Execute(w, data)
+		return
+	}
+	entries, err := auditLog.Query(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(entries) > maxAuditRows {
+		entries = entries[len(entries)-maxAuditRows:]
+		data.Truncated = true
+	}
+	store.Read(func(api *model.Api) error {
+		for idx := len(entries) - 1; idx >= 0; idx-- {
+			data.Rows = append(data.Rows, buildAuditRow(api, &entries[idx]))
+		}
+		return nil
+	})
+	auditPage.Execute(w, data)
+}
+
+//----------------------------------------------------------------------------
+
+/*
+The function auditFilter() makes the audit log filter that the audit page's
+view model (and the skill Uid, when given in place of a path) asks for. When
+the Uid is given, the path shown is filled in from it. The person is
+normalised as the audit log's entries are (see Api.NormaliseEmail()).
+*/
+func auditFilter(data *auditPageData, skill string) (
+	filter audit.Filter, err error) {
+	filter.Person = data.Person
+	err = store.Read(func(api *model.Api) (err error) {
+		if name, err := api.NormaliseEmail(data.Person); err == nil {
+			filter.Person = name
+		}
+		if skill != "" {
+			if filter.SkillId, err = strconv.Atoi(skill); err != nil {
+				return errors.New(model.UnknownSkill)
+			}
+			// The skill may have been removed since.
+			data.Path, _ = api.SkillPath(filter.SkillId)
+			return
+		}
+		if data.Path != "" {
+			filter.SkillId, err = api.ResolvePath(data.Path)
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	if data.From != "" {
+		if filter.From, err = time.ParseInLocation(auditDateFormat,
+			data.From, time.Local); err != nil {
+			return filter, errors.New(badAuditDate)
+		}
+	}
+	if data.To != "" {
+		if filter.To, err = time.ParseInLocation(auditDateFormat,
+			data.To, time.Local); err != nil {
+			return filter, errors.New(badAuditDate)
+		}
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+	return
+}
+
+// The function buildAuditRow() assembles the view model for one entry of the
+// audit log. Skills that no longer exist are shown by their Uid.
+func buildAuditRow(api *model.Api, entry *audit.Entry) (row auditRow) {
+	row = auditRow{
+		Time:    entry.Time.Local().Format("Mon 2 Jan 2006 15:04:05"),
+		Actor:   entry.Actor,
+		Op:      entry.Op,
+		Args:    string(entry.Args),
+		Outcome: "OK",
+	}
+	if entry.Error != "" {
+		row.Outcome = entry.Error
+		row.Failed = true
+	}
+	for _, skillId := range entry.Skills {
+		path, err := api.SkillPath(skillId)
+		switch {
+		case err != nil:
+			path = fmt.Sprintf("#%d (gone)", skillId)
+		case path == "":
+			path = "(top)"
+		}
+		row.Skills = append(row.Skills, path)
+	}
+	return
+}
+
+//----------------------------------------------------------------------------
+
+var auditPage = newPage("audit", auditPageSource)
+
+var auditPageSource = `
+{{define "content"}}
+<p><a href="/admin">Back to admin</a></p>
+<h1>Audit log</h1>
+{{if .Error}}
+<div class="alert alert-danger">{{.Error}}</div>
+{{end}}
+<form method="get" action="/admin/audit" class="form-inline">
+   <input type="text" class="form-control" name="person"
+      placeholder="Person" value="{{.Person}}" />
+   <input type="text" class="form-control" name="path"
+      placeholder="Skill path" value="{{.Path}}" />
+   <input type="text" class="form-control" name="from"
+      placeholder="From yyyy-mm-dd" value="{{.From}}" />
+   <input type="text" class="form-control" name="to"
+      placeholder="To yyyy-mm-dd" value="{{.To}}" />
+   <button type="submit" class="btn btn-default">Filter</button>
+</form>
+
+{{if .Truncated}}
+<p class="text-muted">Only the latest entries are shown.</p>
+{{end}}
+<table class="table table-condensed">
+   <tr>
+      <th>When</th><th>Who</th><th>What</th><th>Skills</th><th>Outcome</th>
+   </tr>
+   {{range .Rows}}
+   <tr{{if .Failed}} class="warning"{{end}}>
+      <td>{{.Time}}</td>
+      <td>{{.Actor}}</td>
+      <td><span title="{{.Args}}">{{.Op}}</span></td>
+      <td>{{range $i, $s := .Skills}}{{if $i}}, {{end}}{{$s}}{{end}}</td>
+      <td>{{.Outcome}}</td>
+   </tr>
+   {{else}}
+   <tr><td colspan="5">Nothing has been recorded that matches.</td></tr>
+   {{end}}
+</table>
+{{end}}
+`
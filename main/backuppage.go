@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+/*
+The backupRow type is the view model for one backup, in the list of them on
+the backups page.
+*/
+type backupRow struct {
+	Name string
+	Time string
+	Size string
+}
+
+/*
+The backupsPageData type is the view model for the admin page that lists the
+backups, and from which one can be taken or restored. The Message reports what
+has just been done.
+*/
+type backupsPageData struct {
+	Rows    []backupRow
+	Message string
+	Error   string
+}
+
+/*
+The adminBackupsHandler() function generates the page that lists the backups.
+*/
+func adminBackupsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := currentAdmin(w, r); !ok {
+		return
+	}
+	showBackupsPage(w, &backupsPageData{Message: r.FormValue("done")})
+}
+
+/*
+The adminBackupNowHandler() function receives the form from the backups page
+that takes a backup straight away.
+*/
+func adminBackupNowHandler(w http.ResponseWriter, r *http.Request) {
+	if requirePost(w, r) == false {
+		return
+	}
+	if _, ok := currentAdmin(w, r); !ok {
+		return
+	}
+	name, err := backups.Backup()
+	if err != nil {
+		showBackupsPage(w, &backupsPageData{Error: err.Error()})
+		return
+	}
+	http.Redirect(w, r, "/admin/backups?done="+
+		url.QueryEscape("Took backup "+name+"."), http.StatusSeeOther)
+}
+
+/*
+The adminRestoreHandler() function receives the restore form from the backups
+page. It asks for confirmation first, and then replaces the model with the
+backup given by the "backup" form value.
+*/
+func adminRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if requirePost(w, r) == false {
+		return
+	}
+	email, ok := currentAdmin(w, r)
+	if !ok {
+		return
+	}
+	name := r.FormValue("backup")
+	if r.PostFormValue("confirm") != "yes" {
+		confirmPage.Execute(w, &confirmPageData{
+			Question: "Replace all the skills and people with those in " +
+				"backup " + name + "? A backup of them is taken first.",
+			Action: "/admin/restore",
+			Backup: name,
+			Cancel: "/admin/backups",
+		})
+		return
+	}
+	if err := backups.Restore(email, name); err != nil {
+		showBackupsPage(w, &backupsPageData{Error: err.Error()})
+		return
+	}
+	http.Redirect(w, r, "/admin/backups?done="+
+		url.QueryEscape("Restored backup "+name+"."), http.StatusSeeOther)
+}
+
+//----------------------------------------------------------------------------
+
+// The function showBackupsPage() renders the backups page, adding the list of
+// backups to the given view model.
+func showBackupsPage(w http.ResponseWriter, data *backupsPageData) {
+	infos, err := backups.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, info := range infos {
+		data.Rows = append(data.Rows, backupRow{Name: info.Name,
+			Time: info.Time.Local().Format("Mon 2 Jan 2006 15:04:05"),
+			Size: fmt.Sprintf("%d KB", (info.Size+1023)/1024)})
+	}
+	backupsPage.Execute(w, data)
+}
+
+//----------------------------------------------------------------------------
+
+var backupsPage = newPage("backups", backupsPageSource)
+
+var backupsPageSource = `
+{{define "content"}}
+<p><a href="/admin">Back to admin</a></p>
+<h1>Backups</h1>
+{{if .Message}}
+<div class="alert alert-success">{{.Message}}</div>
+{{end}}
+{{if .Error}}
+<div class="alert alert-danger">{{.Error}}</div>
+{{end}}
+<form method="post" action="/admin/backups/now" class="form-inline">
+   <button type="submit" class="btn btn-default">Back up now</button>
+</form>
+
+<table class="table table-condensed">
+   {{range .Rows}}
+   <tr>
+      <td>{{.Time}}</td>
+      <td class="text-muted">{{.Size}}</td>
+      <td>
+         <form method="post" action="/admin/restore" class="form-inline">
+            <input type="hidden" name="backup" value="{{.Name}}" />
+            <button type="submit" class="btn btn-link">Restore</button>
+         </form>
+      </td>
+   </tr>
+   {{else}}
+   <tr><td>There are no backups yet.</td></tr>
+   {{end}}
+</table>
+{{end}}
+`
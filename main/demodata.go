@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"github.com/peterhoward42/skilldrill/persist"
+)
+
+// The demoPerson is the person that requests are attributed to when running
+// with demonstration data.
+const demoPerson = "demo.user"
+
+/*
+The function buildDemoData() populates the model with a small taxonomy and a
+few people (the demo person being an admin), so that the server can be tried
+out without any real data. The helper functions skip their command once an
+error has occurred, so that only the first error is reported.
+*/
+func buildDemoData() (err error) {
+	do := func(cmd *persist.Command) {
+		if err == nil {
+			err = store.Do(cmd)
+		}
+	}
+	addPerson := func(email string) {
+		do(&persist.Command{Op: persist.OpAddPerson, Email: email})
+	}
+	addSkill := func(role string, title string, desc string,
+		parent int) (uid int) {
+		cmd := &persist.Command{Op: persist.OpAddSkill, Actor: demoPerson,
+			Role: role, Title: title, Desc: desc, Parent: parent}
+		do(cmd)
+		return cmd.NewUid
+	}
+	give := func(email string, skillId int) {
+		do(&persist.Command{Op: persist.OpGivePersonSkill, Email: email,
+			SkillId: skillId})
+	}
+
+	addPerson(demoPerson)
+	addPerson("fred.bloggs")
+	do(&persist.Command{Op: persist.OpGrantAdmin, Email: demoPerson})
+	root := addSkill(model.Category, "Engineering",
+		"Engineering skills of all kinds", -1)
+	software := addSkill(model.Category, "Software", "Software development",
+		root)
+	languages := addSkill(model.Category, "Languages",
+		"Programming languages", software)
+	golang := addSkill(model.Skill, "Go", "The Go language", languages)
+	python := addSkill(model.Skill, "Python", "The Python language",
+		languages)
+	electronics := addSkill(model.Category, "Electronics",
+		"Electronic design", root)
+	pcb := addSkill(model.Skill, "PCB Layout", "Printed circuit board layout",
+		electronics)
+	give(demoPerson, golang)
+	give("fred.bloggs", golang)
+	give("fred.bloggs", python)
+	give("fred.bloggs", pcb)
+	return
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"github.com/peterhoward42/skilldrill/persist"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const sessionCookie = "skilldrill-session"
+
+/*
+The loginHandler() function shows the login page, which asks only for the
+person's email address. When the form is submitted, a login link is emailed to
+that address, and the page says so.
+*/
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	data := map[string]string{}
+	if r.Method == "POST" {
+		email := strings.TrimSpace(r.FormValue("email"))
+		if err := sendLoginLink(email); err != nil {
+			log.Print(err)
+			data["Error"] = err.Error()
+		} else {
+			data["SentTo"] = email
+		}
+	}
+	loginPage.Execute(w, data)
+}
+
+/*
+The function sendLoginLink() emails a login link for the given address. The
+address is first normalised by the model's identity policy, and it is the
+resulting name that the link logs in as - so that the same person is always
+known by the same name, however they type their address. The link is sent to
+the address the policy gives for that name, and never to the address as typed,
+so that nobody can have a link for someone else sent to themselves.
+*/
+func sendLoginLink(email string) (err error) {
+	if email == "" {
+		return errors.New("Please enter your email address.")
+	}
+	var name, address string
+	err = store.Read(func(api *model.Api) (err error) {
+		name, address, err = api.EmailAddress(email)
+		return
+	})
+	if err != nil {
+		return
+	}
+	token, err := authenticator.NewLoginToken(name)
+	if err != nil {
+		return
+	}
+	link := *baseUrl + "/login/welcome?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf(loginMailBody, link)
+	return mailer.Send(address, "Welcome to Skill Drill", body)
+}
+
+/*
+The welcomeHandler() function receives the requests made by following a login
+link. Following the link only shows a page asking the person to confirm that
+they want to log in, because email scanners fetch the links in messages, and
+would otherwise use up the (single-use) token. Confirming POSTs the token back.
+The person is then registered if they are new, and only once they are known
+to the model is the token redeemed - so that a failure leaves the link usable.
+Finally a session is started by setting the session cookie, and they are taken
+on to the tree page. The cookie is only sent with requests from the site's own
+pages (so that another site cannot make changes on the person's behalf), and
+only over https when the site uses it.
+*/
+func welcomeHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	email, err := authenticator.CheckLoginToken(token)
+	if err != nil {
+		loginPage.Execute(w, map[string]string{"Error": err.Error()})
+		return
+	}
+	if r.Method != "POST" {
+		welcomePage.Execute(w, map[string]string{"Person": email,
+			"Token": token})
+		return
+	}
+	if personExists(email) == false {
+		cmd := &persist.Command{Op: persist.OpAddPerson, Email: email}
+		if err = store.Do(cmd); err != nil {
+			loginPage.Execute(w, map[string]string{"Error": err.Error()})
+			return
+		}
+	}
+	if _, err = authenticator.RedeemLoginToken(token); err != nil {
+		loginPage.Execute(w, map[string]string{"Error": err.Error()})
+		return
+	}
+	session, err := authenticator.NewSession(email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session,
+		Path:     "/",
+		Expires:  time.Now().Add(authenticator.SessionLifetime),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(*baseUrl, "https:"),
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+/*
+The logoutHandler() function ends the session of the person making the
+request, so that the session cookie is no longer accepted, and returns them to
+the login page.
+*/
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if requirePost(w, r) == false {
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		authenticator.EndSession(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   sessionCookie,
+		Value:  "",
+		Path:   "/",
+		MaxAge: -1,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+//----------------------------------------------------------------------------
+
+var loginMailBody = `Hello,
+
+Please follow the link below to start using Skill Drill. The link can only be
+used once. After that, you will stay logged in on the device you used.
+
+%s
+`
+
+var loginPage = newPage("login", loginPageSource)
+
+var welcomePage = newPage("welcome", welcomePageSource)
+
+var loginPageSource = `
+{{define "content"}}
+<h1>Skill Drill</h1>
+{{if .SentTo}}
+<div class="alert alert-success">
+   A welcome email has been sent to {{.SentTo}}. Please follow the link in it
+   to get in.
+</div>
+{{else}}
+{{if .Error}}
+<div class="alert alert-danger">{{.Error}}</div>
+{{end}}
+<form method="post" action="/login">
+   <div class="form-group">
+      <label for="email">Your email address</label>
+      <input type="email" class="form-control" id="email" name="email" />
+   </div>
+   <button type="submit" class="btn btn-primary">Send me a link</button>
+</form>
+{{end}}
+{{end}}
+`
+
+var welcomePageSource = `
+{{define "content"}}
+<h1>Skill Drill</h1>
+<form method="post" action="/login/welcome">
+   <input type="hidden" name="token" value="{{.Token}}" />
+   <p>Welcome {{.Person}}.</p>
+   <button type="submit" class="btn btn-primary">Log in</button>
+</form>
+{{end}}
+`
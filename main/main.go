@@ -1,41 +1,371 @@
+/*
+The main package is the skilldrill web server. It routes incoming requests to
+handlers, and generates the html pages from the templates held in the *page.go
+files. The single in-memory model (an Api from the model package) is owned by
+the store, which loads it from the data directory at startup. Handlers run
+concurrently, so they must only reach the model through the store: queries go
+through store.Read(), and every change is made by passing a persist.Command to
+store.Do(), so that the change is also recorded durably.
+*/
 package main
 
 import (
+	"flag"
+	"fmt"
+	"github.com/peterhoward42/skilldrill/audit"
+	"github.com/peterhoward42/skilldrill/auth"
+	"github.com/peterhoward42/skilldrill/mail"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"github.com/peterhoward42/skilldrill/notify"
+	"github.com/peterhoward42/skilldrill/persist"
+	"gopkg.in/yaml.v2"
 	"html/template"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 )
 
-func myHandler(w http.ResponseWriter, r *http.Request) {
-	data := map[string]string{"subst": "injectedval"}
-	htmlTemplate.Execute(w, data)
-}
+var store *persist.Store
+var backups *persist.Backups
+var auditLog *audit.Log
+var authenticator *auth.Authenticator
+var mailer mail.Mailer
+
+var addr = flag.String("addr", ":12571", "Address for the server to listen on.")
+var dataDir = flag.String("data", "skilldrill-data",
+	"Directory in which to keep the model.")
+var baseUrl = flag.String("baseurl", "http://localhost:12571",
+	"The url at which people reach the server, for use in emailed links.")
+var smtpAddr = flag.String("smtp", "",
+	"Address (host:port) of the SMTP server for sending email. When empty, "+
+		"email is written to the outbox maildir in the data directory "+
+		"instead.")
+var mailFrom = flag.String("mailfrom", "skilldrill@localhost",
+	"The address that email is sent from.")
+var domain = flag.String("domain", "",
+	"The organisation email domain, e.g. example.com. People can only log in "+
+		"with an address in this domain, and email is only sent to it. When "+
+		"empty, nobody can log in by email, and no email is sent.")
+var aliasFile = flag.String("aliases", "",
+	"Optional YAML file that maps alias names to the names they stand for, "+
+		"e.g. \"fbloggs: fred.bloggs\".")
+var firstAdmin = flag.String("admin", "",
+	"Email of a person to appoint as the first admin. This is ignored once "+
+		"the model has an admin.")
+var verifyOnly = flag.Bool("verify", false,
+	"Check the integrity of the model in the data directory, report any "+
+		"problems, and exit - with status 1 if there are any.")
+var repair = flag.Bool("repair", false,
+	"Like -verify, but also repair the problems found, and save the "+
+		"repaired model.")
+var auditDir = flag.String("audit", "",
+	"Directory in which to keep the audit log of changes to the model. When "+
+		"empty, it is kept in the audit directory in the data directory.")
+var backupDir = flag.String("backups", "",
+	"Directory in which to keep backups of the model. When empty, they are "+
+		"kept in the backups directory in the data directory.")
+var backupEvery = flag.Duration("backupevery", persist.DefaultBackupEvery,
+	"How often to back up the model, e.g. 30m or 6h. Zero means never "+
+		"(backups can still be taken from the admin pages).")
+var keepHourly = flag.Int("keephourly", persist.DefaultRetention.Hourly,
+	"The number of hours for which to keep the latest backup in each.")
+var keepDaily = flag.Int("keepdaily", persist.DefaultRetention.Daily,
+	"The number of days for which to keep the latest backup in each.")
+var keepWeekly = flag.Int("keepweekly", persist.DefaultRetention.Weekly,
+	"The number of weeks for which to keep the latest backup in each.")
+var demo = flag.Bool("demo", false,
+	"Populate the model with demonstration data and use the demo person as "+
+		"the default person.")
 
-var templateFile string
-var htmlTemplate *template.Template
+// The notifyQueueSize is the number of notifications that can be waiting to
+// be emailed at once.
+const notifyQueueSize = 1000
 
 func main() {
-	htmlTemplate = template.Must(template.New("fred").Parse(htmlSource))
-	http.HandleFunc("/", myHandler)
-	http.ListenAndServe(":12571", nil)
+	flag.Parse()
+	var err error
+	policy, err := loadIdentityPolicy(*domain, *aliasFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if store, err = persist.NewStore(*dataDir); err != nil {
+		log.Fatal(err)
+	}
+	store.Configure = func(api *model.Api) {
+		api.SetIdentityPolicy(policy)
+	}
+	if err = store.Open(); err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+	if *verifyOnly || *repair {
+		status := checkModel(*repair)
+		store.Close()
+		os.Exit(status)
+	}
+	if problems, _ := store.Verify(false); len(problems) != 0 {
+		log.Printf("The model has %d integrity problems, which have been "+
+			"repaired in memory. Run with -repair to save the repairs.",
+			len(problems))
+	}
+	if authenticator, err = auth.NewAuthenticator(*dataDir); err != nil {
+		log.Fatal(err)
+	}
+	if *smtpAddr != "" {
+		mailer = &mail.SMTPMailer{Addr: *smtpAddr, From: *mailFrom}
+	} else {
+		outbox := filepath.Join(*dataDir, "outbox")
+		mailer = &mail.MaildirMailer{Dir: outbox, From: *mailFrom}
+	}
+	if err = openAuditLog(); err != nil {
+		log.Fatal(err)
+	}
+	defer auditLog.Close()
+	if err = startBackups(); err != nil {
+		log.Fatal(err)
+	}
+	defer backups.Close()
+	notifications := notify.NewQueue(&notify.MailNotifier{Mailer: mailer,
+		Address: policy.Address, BaseUrl: *baseUrl}, notifyQueueSize)
+	defer notifications.Close()
+	store.Notifier = notifications
+	if *firstAdmin != "" {
+		if err = appointFirstAdmin(*firstAdmin); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *demo {
+		defaultPerson = demoPerson
+		if personExists(demoPerson) == false {
+			if err = buildDemoData(); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	http.HandleFunc("/", treeHandler)
+	http.HandleFunc("/login", loginHandler)
+	http.HandleFunc("/login/welcome", welcomeHandler)
+	http.HandleFunc("/logout", logoutHandler)
+	http.HandleFunc("/collapse", collapseHandler)
+	http.HandleFunc("/expand", expandHandler)
+	http.HandleFunc("/undo", undoHandler)
+	http.HandleFunc("/redo", redoHandler)
+	http.HandleFunc("/skill", skillHandler)
+	http.HandleFunc("/skill/holding", skillHoldingHandler)
+	http.HandleFunc("/skill/edit", skillEditHandler)
+	http.HandleFunc("/skill/dismiss", skillDismissHandler)
+	http.HandleFunc("/admin", adminHandler)
+	http.HandleFunc("/admin/grant", adminGrantHandler)
+	http.HandleFunc("/admin/revoke", adminRevokeHandler)
+	http.HandleFunc("/admin/skill", adminSkillHandler)
+	http.HandleFunc("/admin/rename", adminRenameHandler)
+	http.HandleFunc("/admin/move", adminMoveHandler)
+	http.HandleFunc("/admin/merge", adminMergeHandler)
+	http.HandleFunc("/admin/split", adminSplitHandler)
+	http.HandleFunc("/admin/convert", adminConvertHandler)
+	http.HandleFunc("/admin/remove", adminRemoveHandler)
+	http.HandleFunc("/admin/backups", adminBackupsHandler)
+	http.HandleFunc("/admin/backups/now", adminBackupNowHandler)
+	http.HandleFunc("/admin/restore", adminRestoreHandler)
+	http.HandleFunc("/admin/audit", auditHandler)
+	log.Fatal(http.ListenAndServe(*addr, nil))
 }
 
 //----------------------------------------------------------------------------
+// Helpers shared by the handlers
+//----------------------------------------------------------------------------
+
+/*
+The defaultPerson variable holds the email name of the person that requests
+are attributed to, when the request does not belong to a session. It is only
+set when running with demonstration data.
+*/
+var defaultPerson string
+
+/*
+The function currentPerson() works out which person the request comes from,
+using the session cookie. It returns false (having already redirected to the
+login page) when the request does not come from a person known to the model.
+*/
+func currentPerson(w http.ResponseWriter, r *http.Request) (
+	email string, ok bool) {
+	email = defaultPerson
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if sessionEmail, err := authenticator.SessionPerson(
+			cookie.Value); err == nil {
+			email = sessionEmail
+		}
+	}
+	if email == "" || personExists(email) == false {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return "", false
+	}
+	return email, true
+}
+
+/*
+The function requirePost() checks that a request that changes the model uses
+the POST method, so that following a link (perhaps on another site) cannot
+change anything. It returns false (having already responded) when not.
+*/
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Changes must be submitted from a form.",
+			http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// The function personExists() is a convenience wrapper for the Api method of
+// the same name.
+func personExists(email string) (exists bool) {
+	store.Read(func(api *model.Api) error {
+		exists = api.PersonExists(email)
+		return nil
+	})
+	return
+}
+
+/*
+The function appointFirstAdmin() makes the given person an admin (registering
+them first if necessary), provided that the model has no admins yet.
+*/
+func appointFirstAdmin(email string) (err error) {
+	var haveAdmins bool
+	store.Read(func(api *model.Api) error {
+		haveAdmins = len(api.Admins()) != 0
+		return nil
+	})
+	if haveAdmins {
+		log.Printf("Ignoring -admin %s, because there are admins already.",
+			email)
+		return
+	}
+	if personExists(email) == false {
+		cmd := &persist.Command{Op: persist.OpAddPerson, Email: email}
+		if err = store.Do(cmd); err != nil {
+			return
+		}
+	}
+	return store.Do(&persist.Command{Op: persist.OpGrantAdmin, Email: email})
+}
 
-var htmlSource = `
+/*
+The function checkModel() verifies the integrity of the model (repairing it
+when repair is true), prints the problems found, and returns the exit status
+for the process: 1 if there were problems that have not been repaired.
+*/
+func checkModel(repair bool) (status int) {
+	problems, err := store.Verify(repair)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	switch {
+	case err != nil:
+		log.Print(err)
+		return 1
+	case len(problems) == 0:
+		fmt.Println("No problems found.")
+	case repair:
+		fmt.Printf("Repaired %d problems.\n", len(problems))
+	default:
+		fmt.Printf("Found %d problems. Run with -repair to repair them.\n",
+			len(problems))
+		return 1
+	}
+	return 0
+}
+
+// The function openAuditLog() opens the audit log where the command line
+// says, and has the store record every change in it.
+func openAuditLog() (err error) {
+	dir := *auditDir
+	if dir == "" {
+		dir = filepath.Join(*dataDir, "audit")
+	}
+	if auditLog, err = audit.NewLog(dir); err != nil {
+		return
+	}
+	store.Audit = auditLog
+	return
+}
+
+/*
+The function startBackups() sets up the backups of the model, as the command
+line asks, and starts taking them in the background - unless they are only to
+be taken on demand.
+*/
+func startBackups() (err error) {
+	dir := *backupDir
+	if dir == "" {
+		dir = filepath.Join(*dataDir, "backups")
+	}
+	if backups, err = persist.NewBackups(store, dir); err != nil {
+		return
+	}
+	backups.Retention = persist.RetentionPolicy{Hourly: *keepHourly,
+		Daily: *keepDaily, Weekly: *keepWeekly}
+	if *backupEvery > 0 {
+		backups.Interval = *backupEvery
+		backups.Start()
+	}
+	return
+}
+
+/*
+The function loadIdentityPolicy() makes the identity policy for the given
+domain, with the aliases from the given YAML file (when the file name is not
+empty).
+*/
+func loadIdentityPolicy(domain string, aliasFile string) (
+	policy *model.IdentityPolicy, err error) {
+	policy = model.NewIdentityPolicy(domain)
+	if aliasFile == "" {
+		return
+	}
+	content, err := os.ReadFile(aliasFile)
+	if err != nil {
+		return
+	}
+	aliases := map[string]string{}
+	if err = yaml.Unmarshal(content, &aliases); err != nil {
+		return
+	}
+	for alias, name := range aliases {
+		if err = policy.AddAlias(alias, name); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", aliasFile, alias, err)
+		}
+	}
+	return
+}
+
+/*
+The function newPage() makes a template for one page, by combining the common
+layoutSource (and undoSource) with the given page source. The page source must
+define a template called "content".
+*/
+func newPage(name string, pageSource string) *template.Template {
+	layout := template.Must(template.New(name).Parse(layoutSource))
+	template.Must(layout.Parse(undoSource))
+	return template.Must(layout.Parse(pageSource))
+}
 
+//----------------------------------------------------------------------------
+
+var layoutSource = `
 <html lang="en"
    xmlns="http://www.w3.org/1999/xhtml">
    <head>
-      <meta name="generator"
-         content=
-         "HTML Tidy for Linux/x86 (vers 25 March 2009), see www.w3.org" />
       <meta charset="utf-8" />
       <meta http-equiv="X-UA-Compatible"
          content="IE=edge" />
       <meta name="viewport"
          content="width=device-width, initial-scale=1" />
       <title>
-         Bootstrap 101 Template
+         Skill Drill
       </title>
       <!-- Bootstrap -->
       <link rel="stylesheet"
@@ -50,9 +380,9 @@ var htmlSource = `
       <![endif]-->
    </head>
    <body>
-      <h1>
-         Hello, world!
-      </h1>
+      <div class="container">
+         {{template "content" .}}
+      </div>
       <!-- Bootstrap core JavaScript
          ================================================== -->
       <!-- Placed at the end of the document so the pages load faster -->
@@ -63,5 +393,39 @@ var htmlSource = `
          type="text/javascript"></script>
    </body>
 </html>
+`
 
+// The undoSource defines the "undo" template, which shows a person's undo and
+// redo buttons on any page whose view model has the Undo, Redo and Dropped
+// descriptions (from Api.UndoState()), and the page to go Back to. The undo
+// history is forgotten whenever the Store saves a snapshot, so the template
+// warns of that.
+var undoSource = `
+{{define "undo"}}
+{{if .Dropped}}
+<div class="alert alert-warning">
+   The {{.Dropped}} could no longer be undone or redone, so it has been
+   dropped.
+</div>
+{{end}}
+{{if or .Undo .Redo}}
+<p title="Changes can be undone until the skills are next saved, which
+happens every few hundred changes, and when a backup is restored.">
+   {{if .Undo}}
+   <form method="post" action="/undo" style="display: inline">
+      <input type="hidden" name="back" value="{{.Back}}" />
+      <button type="submit" class="btn btn-default btn-sm">
+         Undo {{.Undo}}</button>
+   </form>
+   {{end}}
+   {{if .Redo}}
+   <form method="post" action="/redo" style="display: inline">
+      <input type="hidden" name="back" value="{{.Back}}" />
+      <button type="submit" class="btn btn-default btn-sm">
+         Redo {{.Redo}}</button>
+   </form>
+   {{end}}
+</p>
+{{end}}
+{{end}}
 `
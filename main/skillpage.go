@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"github.com/peterhoward42/skilldrill/persist"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+The skillPageData type is the view model for the skill page. The EditTitle
+and EditDesc fields hold the text to show in the edit form, which differs from
+Title and Desc when an edit has been rejected and is being shown again, along
+with the EditError. When the skill is a category that has been split, and the
+person needs to review the split, NeedsReview is set and Children holds the
+new skills for them to pick from.
+*/
+type skillPageData struct {
+	Person      string
+	Uid         int
+	Title       string
+	Desc        string
+	Breadcrumb  []string
+	IsCategory  bool
+	Holders     []string
+	YouHaveThis bool
+	NeedsReview bool
+	Children    []pickerRow
+	EditTitle   string
+	EditDesc    string
+	EditError   string
+}
+
+/*
+The skillHandler() function generates the page for the skill given by the
+"skill" query parameter.
+*/
+func skillHandler(w http.ResponseWriter, r *http.Request) {
+	email, ok := currentPerson(w, r)
+	if !ok {
+		return
+	}
+	skillId, ok := skillFromRequest(w, r)
+	if !ok {
+		return
+	}
+	data, err := readSkillPageData(email, skillId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	skillPage.Execute(w, data)
+}
+
+/*
+The skillHoldingHandler() function receives the "I have this skill" form from
+the skill page, and toggles whether the person has the skill. It then
+redirects back to the skill page.
+*/
+func skillHoldingHandler(w http.ResponseWriter, r *http.Request) {
+	if requirePost(w, r) == false {
+		return
+	}
+	email, ok := currentPerson(w, r)
+	if !ok {
+		return
+	}
+	skillId, ok := skillFromRequest(w, r)
+	if !ok {
+		return
+	}
+	cmd := &persist.Command{Op: persist.OpTogglePersonSkill, Email: email,
+		SkillId: skillId}
+	if err := store.Do(cmd); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, skillUrl(skillId), http.StatusSeeOther)
+}
+
+/*
+The skillDismissHandler() function receives the form from the skill page with
+which a person says that none of the skills a split skill has been split into
+apply to them. It then redirects back to the skill page.
+*/
+func skillDismissHandler(w http.ResponseWriter, r *http.Request) {
+	if requirePost(w, r) == false {
+		return
+	}
+	email, ok := currentPerson(w, r)
+	if !ok {
+		return
+	}
+	skillId, ok := skillFromRequest(w, r)
+	if !ok {
+		return
+	}
+	cmd := &persist.Command{Op: persist.OpDismissReview, Email: email,
+		SkillId: skillId}
+	if err := store.Do(cmd); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, skillUrl(skillId), http.StatusSeeOther)
+}
+
+/*
+The skillEditHandler() function receives the edit form from the skill page,
+and updates the skill's title and description together. When the model
+rejects the edit, neither is changed, and the skill page is shown again with
+the error alongside the text that was submitted, so that it can be corrected.
+*/
+func skillEditHandler(w http.ResponseWriter, r *http.Request) {
+	if requirePost(w, r) == false {
+		return
+	}
+	email, ok := currentPerson(w, r)
+	if !ok {
+		return
+	}
+	skillId, ok := skillFromRequest(w, r)
+	if !ok {
+		return
+	}
+	newTitle := strings.TrimSpace(r.FormValue("title"))
+	newDesc := strings.TrimSpace(r.FormValue("desc"))
+	err := store.Do(&persist.Command{Op: persist.OpSetSkillWording,
+		Actor: email, SkillId: skillId, Title: newTitle, Desc: newDesc})
+	if err == nil {
+		http.Redirect(w, r, skillUrl(skillId), http.StatusSeeOther)
+		return
+	}
+	data, buildErr := readSkillPageData(email, skillId)
+	if buildErr != nil {
+		http.Error(w, buildErr.Error(), http.StatusBadRequest)
+		return
+	}
+	data.EditTitle = newTitle
+	data.EditDesc = newDesc
+	data.EditError = err.Error()
+	skillPage.Execute(w, data)
+}
+
+// The function readSkillPageData() assembles the view model for the skill
+// page, with the model locked for reading.
+func readSkillPageData(email string, skillId int) (
+	data *skillPageData, err error) {
+	err = store.Read(func(api *model.Api) (err error) {
+		data, err = buildSkillPageData(api, email, skillId)
+		return
+	})
+	return
+}
+
+// The function buildSkillPageData() assembles the view model for the skill
+// page.
+func buildSkillPageData(api *model.Api, email string, skillId int) (
+	data *skillPageData, err error) {
+	data = &skillPageData{Person: email, Uid: skillId}
+	var contextAlone, role string
+	data.Title, data.Desc, _, contextAlone, err = api.SkillWording(skillId)
+	if err != nil {
+		return
+	}
+	if contextAlone != "" {
+		data.Breadcrumb = strings.Split(contextAlone, ">>>")
+	}
+	if _, role, _, err = api.SkillSummary(skillId); err != nil {
+		return
+	}
+	data.IsCategory = role == model.Category
+	var reviews []int
+	if reviews, err = api.NeedsReview(email); err != nil {
+		return
+	}
+	for _, review := range reviews {
+		data.NeedsReview = data.NeedsReview || review == skillId
+	}
+	if data.NeedsReview {
+		var children []int
+		if _, children, err = api.SkillRelations(skillId); err != nil {
+			return
+		}
+		for _, child := range children {
+			row := pickerRow{Uid: child}
+			if row.Title, _, _, err = api.SkillSummary(child); err != nil {
+				return
+			}
+			data.Children = append(data.Children, row)
+		}
+	}
+	if data.IsCategory == false {
+		if data.Holders, err = api.PeopleWithSkill(skillId); err != nil {
+			return
+		}
+		sort.Strings(data.Holders)
+		if data.YouHaveThis, err = api.PersonHasSkill(email,
+			skillId); err != nil {
+			return
+		}
+	}
+	data.EditTitle = data.Title
+	data.EditDesc = data.Desc
+	return
+}
+
+/*
+The function skillFromRequest() extracts the skill Uid from the "skill" form
+value of the request. When there is no "skill" form value, the skill can
+instead be given by its path (see model.FormatPath()) in the "path" form value,
+so that skills have human-readable urls like /skill?path=Software/Languages/Go.
+It returns false (having already written an error response) when the value is
+missing, malformed, or the path does not resolve.
+*/
+func skillFromRequest(w http.ResponseWriter, r *http.Request) (
+	skillId int, ok bool) {
+	if r.FormValue("skill") == "" && r.FormValue("path") != "" {
+		err := store.Read(func(api *model.Api) (err error) {
+			skillId, err = api.ResolvePath(r.FormValue("path"))
+			return
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return 0, false
+		}
+		return skillId, true
+	}
+	skillId, err := strconv.Atoi(r.FormValue("skill"))
+	if err != nil {
+		http.Error(w, model.UnknownSkill, http.StatusBadRequest)
+		return 0, false
+	}
+	return skillId, true
+}
+
+// The function skillUrl() provides the url of the page for the given skill.
+func skillUrl(skillId int) string {
+	return fmt.Sprintf("/skill?skill=%d", skillId)
+}
+
+//----------------------------------------------------------------------------
+
+var skillPage = newPage("skill", skillPageSource)
+
+var skillPageSource = `
+{{define "content"}}
+<p><a href="/#skill-{{.Uid}}">Back to skills</a></p>
+{{if .Breadcrumb}}
+<ol class="breadcrumb">
+   {{range .Breadcrumb}}<li>{{.}}</li>{{end}}
+</ol>
+{{end}}
+<h1>{{.Title}}</h1>
+<p>{{.Desc}}</p>
+
+{{if .NeedsReview}}
+<div class="alert alert-info">
+   <p>You had this skill, but it has been split into the finer-grained skills
+      below. Please open the ones you have, and tick "I have this skill".</p>
+   <ul>
+      {{range .Children}}<li><a href="/skill?skill={{.Uid}}">{{.Title}}</a></li>{{end}}
+   </ul>
+   <form method="post" action="/skill/dismiss">
+      <input type="hidden" name="skill" value="{{.Uid}}" />
+      <button type="submit" class="btn btn-default">None of these apply to me</button>
+   </form>
+</div>
+{{end}}
+
+{{if not .IsCategory}}
+<form method="post" action="/skill/holding">
+   <input type="hidden" name="skill" value="{{.Uid}}" />
+   <div class="checkbox">
+      <label>
+         <input type="checkbox" onchange="this.form.submit()"
+            {{if .YouHaveThis}}checked{{end}} />
+         I have this skill
+      </label>
+   </div>
+   <noscript><button type="submit" class="btn btn-default">Change</button></noscript>
+</form>
+
+<h3>People with this skill</h3>
+<ul>
+   {{range .Holders}}<li>{{.}}</li>{{else}}<li>Nobody yet.</li>{{end}}
+</ul>
+{{end}}
+
+<h3>Edit</h3>
+<form method="post" action="/skill/edit">
+   <input type="hidden" name="skill" value="{{.Uid}}" />
+   {{if .EditError}}
+   <div class="alert alert-danger">{{.EditError}}</div>
+   {{end}}
+   <div class="form-group">
+      <label for="title">Title</label>
+      <input type="text" class="form-control" id="title" name="title"
+         value="{{.EditTitle}}" />
+   </div>
+   <div class="form-group">
+      <label for="desc">Description</label>
+      <textarea class="form-control" id="desc" name="desc"
+         rows="4">{{.EditDesc}}</textarea>
+   </div>
+   <button type="submit" class="btn btn-primary">Save</button>
+</form>
+{{end}}
+`
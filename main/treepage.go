@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"github.com/peterhoward42/skilldrill/persist"
+	"net/http"
+	"strings"
+)
+
+/*
+The treeRow type is the view model for one row of the taxonomy tree page. For
+a category, the HolderCount is of the people who have any skill inside it.
+When the tree is filtered, Matched says whether the row matches the filter (as
+opposed to being shown only because something inside it does).
+*/
+type treeRow struct {
+	Uid         int
+	Title       string
+	Indent      int // pixels
+	IsCategory  bool
+	HasChildren bool
+	Collapsed   bool
+	HolderCount int
+	YouHaveThis bool
+	Matched     bool
+}
+
+/*
+The treeHandler() function generates the taxonomy tree page for the person
+making the request, honouring the tree nodes they have collapsed. When the "q"
+query parameter is given, the tree is filtered to show only the skills that
+match it (and the categories that contain them), regardless of what is
+collapsed.
+*/
+func treeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	email, ok := currentPerson(w, r)
+	if !ok {
+		return
+	}
+	query := strings.TrimSpace(r.FormValue("q"))
+	var rows, reviews []treeRow
+	var undo, redo, dropped string
+	err := store.Read(func(api *model.Api) (err error) {
+		if query == "" {
+			rows, err = buildTreeRows(api, email)
+		} else {
+			rows, err = buildFilteredTreeRows(api, email, query)
+		}
+		if err != nil {
+			return
+		}
+		if reviews, err = buildReviewRows(api, email); err != nil {
+			return
+		}
+		undo, redo, dropped, err = api.UndoState(email)
+		return
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Person":  email,
+		"IsAdmin": isAdmin(email),
+		"Rows":    rows,
+		"Reviews": reviews,
+		"Query":   query,
+		"Undo":    undo,
+		"Redo":    redo,
+		"Dropped": dropped,
+		"Back":    "/",
+	}
+	treePage.Execute(w, data)
+}
+
+// The function buildTreeRows() assembles the view model for the tree page.
+func buildTreeRows(api *model.Api, email string) (rows []treeRow,
+	err error) {
+	skills, depths, counts, err := api.EnumerateTreeWithCounts(email)
+	if err != nil {
+		return
+	}
+	rows = []treeRow{}
+	for idx, skillId := range skills {
+		row := treeRow{Uid: skillId, Indent: depths[idx] * indentPerDepth,
+			HolderCount: counts[idx]}
+		var role string
+		if row.Title, role, row.HasChildren, err = api.SkillSummary(
+			skillId); err != nil {
+			return
+		}
+		row.IsCategory = role == model.Category
+		if row.Collapsed, err = api.IsCollapsed(email, skillId); err != nil {
+			return
+		}
+		if row.IsCategory == false {
+			if row.YouHaveThis, err = api.PersonHasSkill(email,
+				skillId); err != nil {
+				return
+			}
+		}
+		rows = append(rows, row)
+	}
+	return
+}
+
+const indentPerDepth = 24
+
+/*
+The function buildFilteredTreeRows() assembles the view model for the tree page
+when it is filtered by the given query. There are few rows in the results as a
+rule, so the holder counts are worked out row by row.
+*/
+func buildFilteredTreeRows(api *model.Api, email string, query string) (
+	rows []treeRow, err error) {
+	matched := map[int]bool{}
+	for _, skillId := range api.Search(query) {
+		matched[skillId] = true
+	}
+	skills, depths := api.EnumerateMatchingTree(query)
+	rows = []treeRow{}
+	for idx, skillId := range skills {
+		row := treeRow{Uid: skillId, Indent: depths[idx] * indentPerDepth,
+			Matched: matched[skillId]}
+		var role string
+		if row.Title, role, row.HasChildren, err = api.SkillSummary(
+			skillId); err != nil {
+			return
+		}
+		row.IsCategory = role == model.Category
+		if row.HolderCount, err = api.HolderCountBelow(skillId); err != nil {
+			return
+		}
+		if row.IsCategory == false {
+			if row.YouHaveThis, err = api.PersonHasSkill(email,
+				skillId); err != nil {
+				return
+			}
+		}
+		rows = append(rows, row)
+	}
+	return
+}
+
+// The function buildReviewRows() assembles the view model for the list of
+// split skills that the person needs to review.
+func buildReviewRows(api *model.Api, email string) (rows []treeRow,
+	err error) {
+	reviews, err := api.NeedsReview(email)
+	if err != nil {
+		return
+	}
+	rows = []treeRow{}
+	for _, skillId := range reviews {
+		row := treeRow{Uid: skillId, IsCategory: true}
+		if row.Title, _, _, err = api.SkillSummary(skillId); err != nil {
+			return
+		}
+		rows = append(rows, row)
+	}
+	return
+}
+
+/*
+The collapseHandler() function collapses the skill node given by the "skill"
+form value (which must be POSTed), and then redirects back to the tree page - scrolled to the
+row concerned.
+*/
+func collapseHandler(w http.ResponseWriter, r *http.Request) {
+	expandOrCollapse(w, r, persist.OpCollapseSkill)
+}
+
+// The expandHandler() function is the inverse of collapseHandler().
+func expandHandler(w http.ResponseWriter, r *http.Request) {
+	expandOrCollapse(w, r, persist.OpExpandSkill)
+}
+
+// Common implementation for collapseHandler() and expandHandler().
+func expandOrCollapse(w http.ResponseWriter, r *http.Request, op string) {
+	if !requirePost(w, r) {
+		return
+	}
+	email, ok := currentPerson(w, r)
+	if !ok {
+		return
+	}
+	skillId, ok := skillFromRequest(w, r)
+	if !ok {
+		return
+	}
+	cmd := &persist.Command{Op: op, Email: email, SkillId: skillId}
+	if err := store.Do(cmd); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, rowAnchor(skillId), http.StatusSeeOther)
+}
+
+/*
+The undoHandler() function undoes the most recent edit that the person making
+the request made to the skills (see Api.Undo()), and then redirects back to
+the page given by the "back" form value - which is either the admin page, or
+else the tree page.
+*/
+func undoHandler(w http.ResponseWriter, r *http.Request) {
+	undoOrRedo(w, r, persist.OpUndo)
+}
+
+// The redoHandler() function is the inverse of undoHandler().
+func redoHandler(w http.ResponseWriter, r *http.Request) {
+	undoOrRedo(w, r, persist.OpRedo)
+}
+
+// Common implementation for undoHandler() and redoHandler().
+func undoOrRedo(w http.ResponseWriter, r *http.Request, op string) {
+	if requirePost(w, r) == false {
+		return
+	}
+	email, ok := currentPerson(w, r)
+	if !ok {
+		return
+	}
+	if err := store.Do(&persist.Command{Op: op, Actor: email}); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	back := "/"
+	if r.FormValue("back") == "/admin" {
+		back = "/admin"
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// The function rowAnchor() provides the url of the tree page, scrolled to the
+// row for the given skill.
+func rowAnchor(skillId int) string {
+	return fmt.Sprintf("/#skill-%d", skillId)
+}
+
+//----------------------------------------------------------------------------
+
+var treePage = newPage("tree", treePageSource)
+
+var treePageSource = `
+{{define "content"}}
+<h1>Skills</h1>
+<form method="post" action="/logout" class="form-inline">
+   <span class="text-muted">Logged in as {{.Person}}</span>
+   <button type="submit" class="btn btn-link">Log out</button>
+   {{if .IsAdmin}}<a href="/admin" class="btn btn-link">Admin</a>{{end}}
+</form>
+{{template "undo" .}}
+<form method="get" action="/" class="form-inline">
+   <input type="search" class="form-control" name="q" value="{{.Query}}"
+      placeholder="Filter skills" autofocus />
+   <button type="submit" class="btn btn-default">Filter</button>
+   {{if .Query}}<a href="/" class="btn btn-link">Show all</a>{{end}}
+</form>
+{{if .Reviews}}
+<div class="alert alert-info">
+   Some skills you had have been split into finer-grained skills. Please pick
+   the ones you have:
+   {{range .Reviews}}<a href="/skill?skill={{.Uid}}">{{.Title}}</a> {{end}}
+</div>
+{{end}}
+<table class="table table-condensed">
+   {{range .Rows}}
+   <tr id="skill-{{.Uid}}"{{if and $.Query (not .Matched)}} class="text-muted"{{end}}>
+      <td style="padding-left: {{.Indent}}px">
+         {{if .IsCategory}}
+            {{if and .HasChildren (not $.Query)}}
+               <form method="post" style="display: inline"
+                  action="{{if .Collapsed}}/expand{{else}}/collapse{{end}}">
+                  <input type="hidden" name="skill" value="{{.Uid}}" />
+                  <button type="submit" class="btn btn-link btn-xs">
+                     <span class="glyphicon glyphicon-folder-{{if .Collapsed}}close{{else}}open{{end}}"></span></button>
+               </form>
+            {{else}}
+               <span class="glyphicon glyphicon-folder-{{if .HasChildren}}open{{else}}close{{end}}"></span>
+            {{end}}
+            <strong><a href="/skill?skill={{.Uid}}">{{.Title}}</a></strong>
+         {{else}}
+            <span class="glyphicon glyphicon-file"></span>
+            <a href="/skill?skill={{.Uid}}">{{.Title}}</a>
+         {{end}}
+      </td>
+      <td>
+         {{if .IsCategory}}
+         <span class="badge" title="People with skills in this category"
+            style="opacity: 0.6">{{.HolderCount}}</span>
+         {{else}}
+         <span class="badge">{{.HolderCount}}</span>
+         {{end}}
+      </td>
+      <td>
+         {{if .YouHaveThis}}
+         <span class="glyphicon glyphicon-ok" title="You have this"></span>
+         {{end}}
+      </td>
+   </tr>
+   {{else}}
+   {{if .Query}}<tr><td>No skills match "{{.Query}}".</td></tr>{{end}}
+   {{end}}
+</table>
+{{end}}
+`
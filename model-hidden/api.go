@@ -10,8 +10,11 @@ yaml.
 package model
 
 import (
+	"encoding/json"
 	"errors"
+	"github.com/peterhoward42/skilldrill/util/sets"
 	"gopkg.in/yaml.v2"
+	"sort"
 	"strings"
 )
 
@@ -23,26 +26,34 @@ model editing operations should be done via Api calls rather than accessing the
 internal objects directly, so that the integrity of various supplemental look
 up tables is preserved.  The design intent is that none of Api fields are
 exported, but the reason that some are, is solely to facilitate automated
-serialization by yaml.Marshal().
+serialization by yaml.Marshal() and json.Marshal().
 */
 type Api struct {
-	SerializeVers int
-	Skills        []*skillNode
-	People        []*person
-	SkillRoot     int            // root of taxonomy tree (skill.Uid)
-	SkillHoldings *skillHoldings // who has what skill?
-	NextSkill     int
-	UiStates      map[string]*uiState
+	SerializeVers int                 `json:"serializevers"`
+	Skills        []*skillNode        `json:"skills"`
+	People        []*person           `json:"people"`
+	SkillRoot     int                 `json:"skillroot"`     // root of taxonomy tree (skill.Uid)
+	SkillHoldings *skillHoldings      `json:"skillholdings"` // who has what skill?
+	NextSkill     int                 `json:"nextskill"`
+	UiStates      map[string]*uiState `json:"uistates"`
 	// Supplemental, (duplicate) data for quick lookups
 	skillFromId  map[int]*skillNode
 	persFromMail map[string]*person
+	search       *searchIndex
+	history      *undoHistory
+	// Configuration that is not serialized
+	identity *IdentityPolicy
+	// Notifications queued for the caller to deliver
+	notifications []Notification
+	// Problems repaired when the Api was de-serialized
+	repairs []string
 }
 
 // The function NewApi() is a (compulsory) constructor for an initialized, but
 // empty Api struct.
 func NewApi() *Api {
 	return &Api{
-		SerializeVers: 1,
+		SerializeVers: CurrentSerializeVers,
 		Skills:        make([]*skillNode, 0),
 		People:        make([]*person, 0),
 		SkillRoot:     -1,
@@ -50,33 +61,119 @@ func NewApi() *Api {
 		NextSkill:     1,
 		UiStates:      make(map[string]*uiState),
 		// Supplemental fields
-		skillFromId:  make(map[int]*skillNode),
-		persFromMail: make(map[string]*person),
+		skillFromId:   make(map[int]*skillNode),
+		persFromMail:  make(map[string]*person),
+		search:        newSearchIndex(),
+		history:       newUndoHistory(),
+		identity:      NewIdentityPolicy(""),
+		notifications: []Notification{},
 	}
 }
 
-// The function NewFromSerialized() is a factory for an Api based on
-// content previously serialized using the Api.Serialize() method.
+/*
+The method SetIdentityPolicy() replaces the policy by which the Api normalises
+the email addresses given to it to identify people (see IdentityPolicy). The
+policy is configuration rather than data, so it is not serialized, and should
+be set before the Api is used.
+*/
+func (api *Api) SetIdentityPolicy(policy *IdentityPolicy) {
+	api.identity = policy
+}
+
+/*
+The method NormaliseEmail() applies the Api's identity policy to the given
+email address, and returns the name by which the model knows (or would know)
+that person. Can generate the errors: IllegalEmail, WrongDomain.
+*/
+func (api *Api) NormaliseEmail(email string) (name string, err error) {
+	return api.identity.normalise(email)
+}
+
+/*
+The method EmailAddress() applies the Api's identity policy to the given email
+address, and returns both the name by which the model knows (or would know)
+that person, and the address at which they must be emailed - which is not
+necessarily the address given (see IdentityPolicy.Address()). Can generate the
+errors: IllegalEmail, WrongDomain, NoDomain.
+*/
+func (api *Api) EmailAddress(email string) (name string, address string,
+	err error) {
+	if name, err = api.identity.normalise(email); err != nil {
+		return
+	}
+	address, err = api.identity.Address(name)
+	return
+}
+
+/*
+The function NewFromSerialized() is a factory for an Api based on content
+previously serialized using the Api.Serialize() method - by this or an earlier
+version of the software (see migrate.go). Since the content may have been
+edited by hand, or only partly written, it is checked with Verify(), and any
+problems found are repaired. Repairs() reports what they were. Can generate
+the NewerFormat, UnknownFormat and Unrepairable errors, as well as YAML
+errors.
+*/
 func NewFromSerialized(in []byte) (api *Api, err error) {
+	if in, err = migrate(in); err != nil {
+		return
+	}
 	api = NewApi()
 	err = yaml.Unmarshal(in, api)
 	if err != nil {
 		return
 	}
-	api.finishBuildFromDeSerialize()
+	err = api.finishLoad()
 	return
 }
 
+/*
+The function NewFromSerializedJSON() is like NewFromSerialized(), for content
+serialized using the Api.SerializeJSON() method. Content in an earlier format
+is migrated in the same way (JSON being a form of YAML, the migrations can read
+it).
+*/
+func NewFromSerializedJSON(in []byte) (api *Api, err error) {
+	var header struct {
+		SerializeVers int `json:"serializevers"`
+	}
+	if err = json.Unmarshal(in, &header); err != nil {
+		return
+	}
+	if header.SerializeVers != CurrentSerializeVers {
+		return NewFromSerialized(in)
+	}
+	api = NewApi()
+	if err = json.Unmarshal(in, api); err != nil {
+		return
+	}
+	err = api.finishLoad()
+	return
+}
+
+/*
+The method Repairs() describes the problems that were repaired when the Api
+was de-serialized (see NewFromSerialized()). It is empty when there were none.
+*/
+func (api *Api) Repairs() []string {
+	return append([]string{}, api.repairs...)
+}
+
 //--------------------------------------------------------------------------
 // Methods For Adding things to the model
 //--------------------------------------------------------------------------
 
-// The AddPerson() method adds a person to the model in terms of the user name
-// part of their email address. It is an error to add a person that already
-// exists in the model. The email address is coerced to lowercase.
+/*
+The AddPerson() method adds a person to the model in terms of the user name
+part of their email address. The email address is normalised according to the
+identity policy (see SetIdentityPolicy()). It is an error to add a person that
+already exists in the model. Errors: PersonExists, IllegalEmail, WrongDomain.
+*/
 func (api *Api) AddPerson(email string) (err error) {
+	if email, err = api.identity.normalise(email); err != nil {
+		return
+	}
 	// disallow duplicate additions
-	email = strings.ToLower(email)
 	_, ok := api.persFromMail[email]
 	if ok {
 		return errors.New(PersonExists)
@@ -98,15 +195,30 @@ and should not duplicate context information.  You specify the tree location by
 providing the Uid of the parent skill, and the new Uid for the added skill is
 returned.  The role parameter should be one of the constants Skill or Category.
 When the skill tree is empty, this skill will be added as the root, and the
-parentUid parameter is ignored.  Errors are generated if you attempt to add a
+parentUid parameter is ignored.  The actor is recorded as the skill's creator,
+and may be empty when not known.  Errors are generated if you attempt to add a
 skill to a node that is not a Category, or if the parent skill you provide is
-not recognized.
+not recognized, or the actor is not (UnknownPerson). The title and description
+are trimmed, and must follow the rules in validation.go (EmptyTitle,
+IllegalTitle, TooLong, DuplicateTitle).
 */
-func (api *Api) AddSkill(role string, title string, desc string,
+func (api *Api) AddSkill(actor string, role string, title string, desc string,
 	parent int) (uid int, err error) {
 
 	// Be sure to keep this symmetrical with RemoveSkill
 
+	if err = tidyTitle(&title); err != nil {
+		return
+	}
+	if err = tidyDesc(&desc); err != nil {
+		return
+	}
+	if actor != "" {
+		if err = api.tweakParams(&actor, nil); err != nil {
+			return
+		}
+	}
+
 	// Sanitize parent except when adding root skill
 	if api.SkillRoot != -1 {
 		parentSkill, ok := api.skillFromId[parent]
@@ -118,14 +230,20 @@ func (api *Api) AddSkill(role string, title string, desc string,
 			err = errors.New(ParentNotCategory)
 			return
 		}
+		if err = api.checkUniqueTitle(parent, -1, title); err != nil {
+			return
+		}
 	}
 	uid = api.NextSkill
 	api.NextSkill++
 	newSkill := newSkillNode(uid, role, title, desc, parent, api)
+	newSkill.Creator = actor
+	newSkill.Editor = actor
 	// Note we keep the children - in alphabetical order of title
 	api.Skills = append(api.Skills, newSkill)
 	api.skillFromId[uid] = newSkill
 	api.SkillHoldings.registerSkill(uid)
+	api.search.index(newSkill)
 
 	if api.SkillRoot == -1 {
 		api.SkillRoot = uid
@@ -133,6 +251,8 @@ func (api *Api) AddSkill(role string, title string, desc string,
 	}
 	parentSkill := api.skillFromId[parent]
 	parentSkill.addChild(newSkill.Uid)
+	api.history.record(actor, &edit{kind: editAdd, skill: uid, title: title,
+		touched: []int{uid}, parents: []int{parent}})
 	return
 }
 
@@ -141,7 +261,7 @@ The GivePersonSkill() method adds the given skill into the set of skills the
 model holds for that person.  You are only allowed to give people Skill, not
 CATEGORIES.  An error is generated if either the person or skill given are not
 recognized, or you give a person a Category rather than a Skill. The email you
-provide is lower-cased before it is used.
+provide is normalised before it is used.
 */
 func (api *Api) GivePersonSkill(email string, skillId int) (err error) {
 	if err = api.tweakParams(&email, &skillId); err != nil {
@@ -154,6 +274,58 @@ func (api *Api) GivePersonSkill(email string, skillId int) (err error) {
 	}
 	foundPerson := api.persFromMail[email]
 	api.SkillHoldings.bind(foundSkill.Uid, foundPerson.Email)
+	// Picking a skill settles the review of a split skill that contains it.
+	treeOps := &skillTreeOps{api}
+	lineage := []*skillNode{}
+	treeOps.lineageOf(foundSkill, &lineage)
+	for _, ancestor := range lineage {
+		api.UiStates[email].NeedsReview.RemoveIfPresent(ancestor.Uid)
+	}
+	return
+}
+
+/*
+The RemovePersonSkill() method is the inverse of GivePersonSkill(). It takes
+the given skill out of the set of skills the model holds for that person, so
+that people can correct mistaken claims. An error is generated if either the
+person or skill given are not recognized, if the skill is a Category, or if the
+person does not hold the skill (NotHeld). The email you provide is normalised
+before it is used.
+*/
+func (api *Api) RemovePersonSkill(email string, skillId int) (err error) {
+	if err = api.tweakParams(&email, &skillId); err != nil {
+		return
+	}
+	foundSkill := api.skillFromId[skillId]
+	if foundSkill.Role == Category {
+		err = errors.New(CannotBestowCategory)
+		return
+	}
+	if api.SkillHoldings.holds(skillId, email) == false {
+		err = errors.New(NotHeld)
+		return
+	}
+	api.SkillHoldings.unbind(foundSkill.Uid, email)
+	return
+}
+
+/*
+The TogglePersonSkill() method gives the person the skill if they do not have
+it, and takes it away if they do - as required by an "I have this skill"
+checkbox. It returns whether the person holds the skill afterwards. The errors
+are as for GivePersonSkill().
+*/
+func (api *Api) TogglePersonSkill(email string, skillId int) (
+	hasSkill bool, err error) {
+	if hasSkill, err = api.PersonHasSkill(email, skillId); err != nil {
+		return
+	}
+	if hasSkill {
+		err = api.RemovePersonSkill(email, skillId)
+	} else {
+		err = api.GivePersonSkill(email, skillId)
+	}
+	hasSkill = !hasSkill
 	return
 }
 
@@ -176,6 +348,20 @@ func (api *Api) CollapseSkill(email string, skillId int) (err error) {
 	return
 }
 
+/*
+The ExpandSkill() method is the inverse of CollapseSkill(). It is harmless to
+expand a node that is not collapsed. Errors are generated when either the
+person or the skill is not recognized.
+*/
+func (api *Api) ExpandSkill(email string, skillId int) (err error) {
+	if err = api.tweakParams(&email, &skillId); err != nil {
+		return
+	}
+	foundSkill := api.skillFromId[skillId]
+	api.UiStates[email].expandNode(foundSkill)
+	return
+}
+
 //--------------------------------------------------------------------------
 // Getter Style Methods
 //--------------------------------------------------------------------------
@@ -197,6 +383,120 @@ func (api *Api) SkillWording(skillId int) (title string, desc string,
 	return
 }
 
+/*
+The method SkillSummary() returns the information about the given skill that
+is needed to display it as a row in the tree, i.e. its title, its role (Skill
+or Category), and whether it has children. Can generate the UnknownSkill
+error.
+*/
+func (api *Api) SkillSummary(skillId int) (title string, role string,
+	hasChildren bool, err error) {
+	if err = api.tweakParams(nil, &skillId); err != nil {
+		return
+	}
+	foundSkill := api.skillFromId[skillId]
+	title = foundSkill.Title
+	role = foundSkill.Role
+	hasChildren = len(foundSkill.Children) != 0
+	return
+}
+
+/*
+The method SkillRelations() provides the Uid of the given skill's parent (-1
+for the root), and the Uids of its children, in the order they appear in the
+tree. Can generate the UnknownSkill error.
+*/
+func (api *Api) SkillRelations(skillId int) (parent int, children []int,
+	err error) {
+	if err = api.tweakParams(nil, &skillId); err != nil {
+		return
+	}
+	foundSkill := api.skillFromId[skillId]
+	parent = foundSkill.Parent
+	children = append([]int{}, foundSkill.Children...)
+	return
+}
+
+/*
+The method SkillAuthors() provides the emails of the person who added the given
+skill, and of the person who last changed it. Either is empty when not known.
+Can generate the UnknownSkill error.
+*/
+func (api *Api) SkillAuthors(skillId int) (creator string, editor string,
+	err error) {
+	if err = api.tweakParams(nil, &skillId); err != nil {
+		return
+	}
+	foundSkill := api.skillFromId[skillId]
+	return foundSkill.Creator, foundSkill.Editor, nil
+}
+
+/*
+The method SkillPath() provides the skill path of the given skill (see
+FormatPath()). Can generate the UnknownSkill error.
+*/
+func (api *Api) SkillPath(skillId int) (path string, err error) {
+	if err = api.tweakParams(nil, &skillId); err != nil {
+		return
+	}
+	treeOps := &skillTreeOps{api}
+	lineage := []*skillNode{}
+	treeOps.lineageOf(api.skillFromId[skillId], &lineage)
+	titles := []string{}
+	for _, skill := range lineage[1:] {
+		titles = append(titles, skill.Title)
+	}
+	return FormatPath(titles), nil
+}
+
+/*
+The method ResolvePath() is the inverse of SkillPath(), and provides the Uid of
+the skill with the given path. Titles are matched ignoring case, so that paths
+typed by people can be resolved. Can generate the following errors:
+MalformedPath, UnknownPath, and AmbiguousPath (when more than one skill at
+some level of the tree has the title given).
+*/
+func (api *Api) ResolvePath(path string) (skillId int, err error) {
+	titles, err := ParsePath(path)
+	if err != nil {
+		return
+	}
+	if api.SkillRoot == -1 {
+		return -1, errors.New(UnknownPath)
+	}
+	skillId = api.SkillRoot
+	for _, title := range titles {
+		matches := []int{}
+		for _, child := range api.skillFromId[skillId].Children {
+			if strings.EqualFold(api.skillFromId[child].Title, title) {
+				matches = append(matches, child)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return -1, errors.New(UnknownPath)
+		case 1:
+			skillId = matches[0]
+		default:
+			return -1, errors.New(AmbiguousPath)
+		}
+	}
+	return
+}
+
+/*
+The method SkillAliases() provides the alternative titles recorded for the
+given skill, which are the titles of the skills that have been merged into it
+(see MergeSkills()). Can generate the UnknownSkill error.
+*/
+func (api *Api) SkillAliases(skillId int) (aliases []string, err error) {
+	if err = api.tweakParams(nil, &skillId); err != nil {
+		return
+	}
+	aliases = append([]string{}, api.skillFromId[skillId].Aliases...)
+	return
+}
+
 /*
 The method PeopleWithSkill() provides a list of the people (email address) who
 hold the given skill. Can generate the following errors: UnknownSkill,
@@ -215,11 +515,40 @@ func (api *Api) PeopleWithSkill(skillId int) (emails []string, err error) {
 }
 
 /*
-The method PersonExists() returns true if the given person is registered.
+The method PeopleWithSkillBelow() aggregates PeopleWithSkill() up the
+hierarchy. It provides the people who hold the given skill, or - when it is a
+category - any skill beneath it in the tree. Each person is listed once, and
+the list is sorted. Can generate the UnknownSkill error.
+*/
+func (api *Api) PeopleWithSkillBelow(skillId int) (emails []string,
+	err error) {
+	if err = api.tweakParams(nil, &skillId); err != nil {
+		return
+	}
+	treeOps := &skillTreeOps{api}
+	holders := treeOps.holdersBelow(api.skillFromId[skillId],
+		map[int]*sets.SetOfString{})
+	emails = append([]string{}, holders.AsSlice()...)
+	sort.Strings(emails)
+	return
+}
+
+/*
+The method HolderCountBelow() provides how many people PeopleWithSkillBelow()
+would list for the given skill. Can generate the UnknownSkill error.
+*/
+func (api *Api) HolderCountBelow(skillId int) (count int, err error) {
+	emails, err := api.PeopleWithSkillBelow(skillId)
+	count = len(emails)
+	return
+}
+
+/*
+The method PersonExists() returns true if the given person is registered. The
+email you provide is normalised before it is used.
 */
 func (api *Api) PersonExists(email string) bool {
-	_, exists := api.persFromMail[email]
-	return exists
+	return api.tweakParams(&email, nil) == nil
 }
 
 /*
@@ -245,11 +574,26 @@ func (api *Api) PersonHasSkill(email string, skillId int) (
 	return
 }
 
+/*
+The method IsCollapsed() returns true if the given person has collapsed the
+given skill node (using CollapseSkill()). Can generate the following errors:
+UnknownPerson, UnknownSkill.
+*/
+func (api *Api) IsCollapsed(email string, skillId int) (
+	collapsed bool, err error) {
+	if err = api.tweakParams(&email, &skillId); err != nil {
+		return
+	}
+	collapsed = api.UiStates[email].CollapsedNodes.Contains(skillId)
+	return
+}
+
 /*
 The method EnumerateTree() provides a list of skill Uids in the order they
 should appear when displaying the tree. It is person-specific, and omits the
 nodes that have been collapsed (using CollapseSkill()) - including their
-children. Can generate the UnknownPerson error.
+children. The lists are empty when no skills have been added yet. Can generate
+the UnknownPerson error.
 */
 func (api *Api) EnumerateTree(email string) (skills []int,
 	depths []int, err error) {
@@ -262,83 +606,279 @@ func (api *Api) EnumerateTree(email string) (skills []int,
 	return
 }
 
+/*
+The method EnumerateTreeWithCounts() is like EnumerateTree(), and additionally
+provides, for each skill it lists, how many people HolderCountBelow() would
+report. The counts come from a single walk of the tree, so this is the one to
+use for showing counts on every row. Collapsing a category does not change its
+count. Can generate the UnknownPerson error.
+*/
+func (api *Api) EnumerateTreeWithCounts(email string) (skills []int,
+	depths []int, counts []int, err error) {
+	if skills, depths, err = api.EnumerateTree(email); err != nil {
+		return
+	}
+	holders := map[int]*sets.SetOfString{}
+	if api.SkillRoot != -1 {
+		treeOps := &skillTreeOps{api}
+		treeOps.holdersBelow(api.skillFromId[api.SkillRoot], holders)
+	}
+	counts = []int{}
+	for _, skillId := range skills {
+		counts = append(counts, len(holders[skillId].AsSlice()))
+	}
+	return
+}
+
+/*
+The method Search() provides the skills (and categories) whose wording matches
+the query, best match first. The query is broken into words, and a skill
+matches when every one of them is the start of a word in the skill's title,
+aliases or description - ignoring case. Matches in the title rank above
+matches in the description, and skills that rank equally are in the order they
+appear in the tree. A query with no words matches nothing.
+*/
+func (api *Api) Search(query string) (skills []int) {
+	scores := api.search.search(query)
+	skills = []int{}
+	wholeTree, _ := api.EnumerateWholeTree()
+	for _, skillId := range wholeTree {
+		if _, ok := scores[skillId]; ok {
+			skills = append(skills, skillId)
+		}
+	}
+	sort.SliceStable(skills, func(i, j int) bool {
+		return scores[skills[i]] > scores[skills[j]]
+	})
+	return
+}
+
+/*
+The method EnumerateMatchingTree() is like EnumerateWholeTree(), except that it
+includes only the skills that match the query (see Search()), along with their
+ancestors, so that the results can still be shown as a tree. An empty query
+matches everything.
+*/
+func (api *Api) EnumerateMatchingTree(query string) (skills []int,
+	depths []int) {
+	if len(tokenise(query)) == 0 {
+		return api.EnumerateWholeTree()
+	}
+	treeOps := &skillTreeOps{api}
+	included := sets.NewSetOfInt()
+	for skillId := range api.search.search(query) {
+		lineage := []*skillNode{}
+		treeOps.lineageOf(api.skillFromId[skillId], &lineage)
+		for _, ancestor := range lineage {
+			included.Add(ancestor.Uid)
+		}
+	}
+	return treeOps.enumerateSubset(included)
+}
+
+/*
+The method EnumerateWholeTree() is like EnumerateTree(), except that it is not
+person-specific, and so includes every node in the tree.
+*/
+func (api *Api) EnumerateWholeTree() (skills []int, depths []int) {
+	treeOps := &skillTreeOps{api}
+	return treeOps.enumerateTree(sets.NewSetOfInt())
+}
+
 //--------------------------------------------------------------------------
 // Methods That Change Existing Content
 //--------------------------------------------------------------------------
 
 /*
 The SetSkillTitle() method replaces the given skill's title with the text
-given. Can generate the following errors: SkillUnknown error, TooLong.
+given, and records the actor as the skill's last editor. When the title
+changes, and the actor is not the skill's creator, the creator is notified.
+The title is trimmed. Can generate the following errors: UnknownPerson,
+SkillUnknown error, EmptyTitle, IllegalTitle, TooLong, DuplicateTitle.
 */
-func (api *Api) SetSkillTitle(skillId int, newTitle string) (err error) {
-	if err = api.tweakParams(nil, &skillId); err != nil {
+func (api *Api) SetSkillTitle(actor string, skillId int, newTitle string) (
+	err error) {
+	if err = api.tweakParams(&actor, &skillId); err != nil {
 		return
 	}
 	skill := api.skillFromId[skillId]
-	if len(newTitle) > MaxSkillTitle {
-		err = errors.New(TooLong)
+	if err = tidyTitle(&newTitle); err != nil {
 		return
 	}
+	if skillId != api.SkillRoot {
+		if err = api.checkUniqueTitle(skill.Parent, skillId,
+			newTitle); err != nil {
+			return
+		}
+	}
+	if newTitle != skill.Title {
+		api.notifyCreator(actor, skill, Renamed)
+		api.history.record(actor, &edit{kind: editTitle, skill: skillId,
+			title: newTitle, touched: []int{skillId},
+			text: [2]string{skill.Title, newTitle}})
+	}
 	skill.Title = newTitle
+	skill.Editor = actor
+	api.search.index(skill)
+	if skillId != api.SkillRoot {
+		api.skillFromId[skill.Parent].sortChildren()
+	}
 	return
 }
 
 /*
 The SetSkillDesc() method replaces the given skill's description with the text
-given. Can generate the following errors: SkillUnknown error, TooLong.
+given, and records the actor as the skill's last editor. When the description
+changes, and the actor is not the skill's creator, the creator is notified.
+The description is trimmed. Can generate the following errors: UnknownPerson,
+SkillUnknown error, TooLong.
 */
-func (api *Api) SetSkillDesc(skillId int, newDesc string) (err error) {
-	if err = api.tweakParams(nil, &skillId); err != nil {
+func (api *Api) SetSkillDesc(actor string, skillId int, newDesc string) (
+	err error) {
+	if err = api.tweakParams(&actor, &skillId); err != nil {
 		return
 	}
-	if len(newDesc) > MaxSkillDesc {
-		err = errors.New(TooLong)
+	if err = tidyDesc(&newDesc); err != nil {
 		return
 	}
 	skill := api.skillFromId[skillId]
+	if newDesc != skill.Desc {
+		api.notifyCreator(actor, skill, Redescribed)
+		api.history.record(actor, &edit{kind: editDesc, skill: skillId,
+			title: skill.Title, touched: []int{skillId},
+			text: [2]string{skill.Desc, newDesc}})
+	}
 	skill.Desc = newDesc
+	skill.Editor = actor
+	api.search.index(skill)
 	return
 }
 
 /*
-The method ReParentSkill() moves a skill node and all its children to a
-different position in the tree. The new parent given must be a skill node with
-the CATEGORY role. The following errors can be generated: UnknownSkill,
-IllegalWithRoot, and ParentNotCategory.
+The SetSkillWording() method sets both the title and the description of the
+given skill, as SetSkillTitle() and SetSkillDesc() do, but checks both first,
+so that either both are changed or neither is. When both change, the change is
+undone as one edit. Can generate the errors of SetSkillTitle() and
+SetSkillDesc().
 */
-func (api *Api) ReParentSkill(toMove int, newParent int) (err error) {
-	if err = api.tweakParams(nil, &toMove); err != nil {
+func (api *Api) SetSkillWording(actor string, skillId int, newTitle string,
+	newDesc string) (err error) {
+	if err = api.tweakParams(&actor, &skillId); err != nil {
 		return
 	}
-	if err = api.tweakParams(nil, &newParent); err != nil {
+	skill := api.skillFromId[skillId]
+	if err = tidyTitle(&newTitle); err != nil {
 		return
 	}
-	if toMove == api.SkillRoot {
-		return errors.New(IllegalWithRoot)
+	if err = tidyDesc(&newDesc); err != nil {
+		return
+	}
+	if skillId != api.SkillRoot {
+		if err = api.checkUniqueTitle(skill.Parent, skillId,
+			newTitle); err != nil {
+			return
+		}
+	}
+	both := newTitle != skill.Title && newDesc != skill.Desc
+	wording := &edit{kind: editWording, skill: skillId, title: newTitle,
+		touched: []int{skillId}, text: [2]string{skill.Title, newTitle},
+		desc: [2]string{skill.Desc, newDesc}}
+	busy := api.history.busy
+	api.history.busy = busy || both
+	// Neither can fail, having passed the checks above.
+	api.SetSkillTitle(actor, skillId, newTitle)
+	api.SetSkillDesc(actor, skillId, newDesc)
+	api.history.busy = busy
+	if both {
+		api.history.record(actor, wording)
+	}
+	return
+}
+
+/*
+The method ReParentSkill() moves a skill node and all its children to a
+different position in the tree. The new parent given must be a skill node with
+the CATEGORY role, and must not be the skill itself or one of its descendants.
+Only an admin (the actor) may do this. The following errors can be generated:
+PermissionDenied, UnknownSkill, IllegalWithRoot, ParentNotCategory and
+IllegalCycle. The moved skill records the actor as its last editor, and the
+creators of the moved skills are notified - once each, about the first of their
+skills in the moved subtree. See also PreviewReParentSkill().
+*/
+func (api *Api) ReParentSkill(actor string, toMove int, newParent int) (
+	err error) {
+	if err = api.checkReParent(&actor, toMove, newParent); err != nil {
+		return
 	}
 	childSkill := api.skillFromId[toMove]
 	oldParentSkill := api.skillFromId[childSkill.Parent]
 	newParentSkill := api.skillFromId[newParent]
-
-	if newParentSkill.Role != Category {
-		return errors.New(ParentNotCategory)
+	if newParent == childSkill.Parent {
+		return
+	}
+	treeOps := &skillTreeOps{api}
+	notified := sets.NewSetOfString()
+	for _, moved := range treeOps.subTree(childSkill) {
+		movedSkill := api.skillFromId[moved]
+		if notified.Contains(movedSkill.Creator) == false {
+			notified.Add(movedSkill.Creator)
+			api.notifyCreator(actor, movedSkill, Moved)
+		}
 	}
+	api.history.record(actor, &edit{kind: editMove, skill: toMove,
+		title: childSkill.Title, touched: []int{toMove},
+		parents: []int{childSkill.Parent, newParent},
+		parent:  [2]int{childSkill.Parent, newParent}})
 	oldParentSkill.removeChild(toMove)
 	newParentSkill.addChild(toMove)
 	childSkill.Parent = newParent
+	childSkill.Editor = actor
+	return
+}
+
+/*
+The method PreviewReParentSkill() is a dry-run of ReParentSkill(). It makes the
+same checks, and generates the same errors, but instead of moving the skill,
+it reports the skills that would move (the skill itself and all its
+descendants, in tree order), and the people who hold any of those skills
+(sorted, without duplicates). The model is not changed.
+*/
+func (api *Api) PreviewReParentSkill(actor string, toMove int,
+	newParent int) (skills []int, holders []string, err error) {
+	if err = api.checkReParent(&actor, toMove, newParent); err != nil {
+		return
+	}
+	treeOps := &skillTreeOps{api}
+	skills = treeOps.subTree(api.skillFromId[toMove])
+	holderSet := sets.NewSetOfString()
+	for _, skillId := range skills {
+		for _, email := range api.SkillHoldings.PeopleWithSkill[skillId].
+			AsSlice() {
+			holderSet.Add(email)
+		}
+	}
+	holders = append([]string{}, holderSet.AsSlice()...)
+	sort.Strings(holders)
 	return
 }
 
 /*
 The RemovePerson() method removes a previously registered person from the model
-in terms of the user name part of their email address. It is an error to pass
-in a person that does not exist in the model. The email address is coerced to
-lowercase.
+in terms of the user name part of their email address. Only an admin (the
+actor) may do this. It is an error to pass in a person that does not exist in
+the model, or to remove the last admin. The email address is normalised before
+it is used. Errors: PermissionDenied, UnknownPerson, LastAdmin.
 */
-func (api *Api) RemovePerson(email string) (err error) {
+func (api *Api) RemovePerson(actor string, email string) (err error) {
+	if err = api.requireAdmin(&actor); err != nil {
+		return
+	}
 	if err = api.tweakParams(&email, nil); err != nil {
 		return
 	}
+	if err = api.checkNotLastAdmin(email); err != nil {
+		return
+	}
 	// be sure to keep this symmetrical with AddPerson()
 	departingPerson := api.persFromMail[email]
 	oldList := api.People
@@ -351,49 +891,351 @@ func (api *Api) RemovePerson(email string) (err error) {
 	delete(api.persFromMail, email)
 	api.SkillHoldings.UnRegisterPerson(*departingPerson)
 	delete(api.UiStates, email)
+	api.history.forget(email)
 	return
 }
 
 /*
 The RemoveSkill() method removes a skill from the model's hierachy of skills.
-It can generate the following errors: UnknownSkill,
-CannotRemoveSkillWithChildren, CannotRemoveRootSkill. CannotRemoveSkillHeld.
+Only an admin (the actor) may do this, and the skill's creator is notified. It
+can generate the following errors:
+PermissionDenied, UnknownSkill, CannotRemoveSkillWithChildren,
+CannotRemoveRootSkill. CannotRemoveSkillHeld.
 */
-func (api *Api) RemoveSkill(skillId int) (err error) {
-	// Be sure to keep this symmetrical with AddSkill
+func (api *Api) RemoveSkill(actor string, skillId int) (err error) {
+	if err = api.requireAdmin(&actor); err != nil {
+		return
+	}
+	// Be sure to keep this symmetrical with AddSkill (see takeSkill())
+	removed, err := api.takeSkill(actor, skillId)
+	if err != nil {
+		return
+	}
+	api.history.record(actor, &edit{kind: editRemove, skill: skillId,
+		title: removed.node.Title, touched: []int{skillId},
+		parents: []int{removed.node.Parent}, removed: removed})
+	return
+}
+
+/*
+The MergeSkills() method resolves the duplication of two skills that mean the
+same thing, by absorbing one into the other (the one to keep). Everybody who
+holds the absorbed skill is given the kept one instead, anybody who has
+collapsed the absorbed node has the kept one collapsed instead, the children
+of an absorbed Category move into the kept one, and the absorbed skill's title
+is recorded as an alias of the kept one. The absorbed skill is then removed,
+and its creator notified. Only an admin (the actor) may do this. Both skills
+must have the same role, and the skill to keep must not be inside the one
+absorbed. Errors: PermissionDenied, UnknownSkill, CannotMergeWithItself,
+RoleMismatch, IllegalWithRoot, IllegalCycle.
+*/
+func (api *Api) MergeSkills(actor string, keep int, absorb int) (err error) {
+	if err = api.requireAdmin(&actor); err != nil {
+		return
+	}
+	if err = api.tweakParams(nil, &keep); err != nil {
+		return
+	}
+	if err = api.tweakParams(nil, &absorb); err != nil {
+		return
+	}
+	if keep == absorb {
+		return errors.New(CannotMergeWithItself)
+	}
+	keptSkill := api.skillFromId[keep]
+	absorbedSkill := api.skillFromId[absorb]
+	if keptSkill.Role != absorbedSkill.Role {
+		return errors.New(RoleMismatch)
+	}
+	if absorb == api.SkillRoot {
+		return errors.New(IllegalWithRoot)
+	}
+	treeOps := &skillTreeOps{api}
+	lineage := []*skillNode{}
+	treeOps.lineageOf(keptSkill, &lineage)
+	for _, ancestor := range lineage {
+		if ancestor.Uid == absorb {
+			return errors.New(IllegalCycle)
+		}
+	}
+	for _, child := range absorbedSkill.Children {
+		if err = api.checkUniqueTitle(keep, absorb,
+			api.skillFromId[child].Title); err != nil {
+			return
+		}
+	}
+
+	api.notifyCreator(actor, absorbedSkill, Merged)
+	api.history.conflict(append([]int{keep, absorb},
+		absorbedSkill.Children...))
+	for _, child := range absorbedSkill.Children {
+		keptSkill.addChild(child)
+		api.skillFromId[child].Parent = keep
+	}
+	absorbedSkill.Children = []int{}
+	api.SkillHoldings.transfer(absorb, keep)
+	for _, uiState := range api.UiStates {
+		uiState.notifySkillIsMerged(absorb, keep)
+	}
+	keptSkill.addAlias(absorbedSkill.Title)
+	for _, alias := range absorbedSkill.Aliases {
+		keptSkill.addAlias(alias)
+	}
+	keptSkill.Editor = actor
+	api.search.index(keptSkill)
+	api.removeSkillNode(absorbedSkill)
+	return
+}
+
+/*
+The method TakeNotifications() provides the notifications that have been
+queued by the changes made since it was last called, in the order they were
+made, and empties the queue.
+*/
+func (api *Api) TakeNotifications() (notifications []Notification) {
+	notifications = api.notifications
+	api.notifications = []Notification{}
+	return
+}
+
+/*
+The NewChild type describes one of the skills that a skill is split into by
+SplitSkill().
+*/
+type NewChild struct {
+	Title string `json:"title"`
+	Desc  string `json:"desc"`
+}
+
+/*
+The SplitSkill() method refines a Skill into several finer-grained ones. The
+skill becomes a Category, and the children described are added to it (in the
+order given, which determines their Uids, and these are returned). People
+cannot hold a Category, so each person who held the skill is either given one
+of the new children instead - when the reassign map gives the index (into
+children) of the child for them - or otherwise is marked as needing to review
+the split, so they can be prompted to pick the children that apply. Picking
+one with GivePersonSkill() settles the review, as does DismissReview(). Only an
+admin (the actor) may do this, and the skill's creator is notified. Everything
+is checked before anything is changed. Errors: PermissionDenied, UnknownSkill,
+CannotSplitCategory, NoChildren, TooLong, DuplicateTitle, UnknownPerson,
+NotHeld, UnknownChild.
+*/
+func (api *Api) SplitSkill(actor string, skillId int, children []NewChild,
+	reassign map[string]int) (uids []int, err error) {
+	if err = api.requireAdmin(&actor); err != nil {
+		return
+	}
+	if err = api.tweakParams(nil, &skillId); err != nil {
+		return
+	}
+	skill := api.skillFromId[skillId]
+	if skill.Role != Skill {
+		return nil, errors.New(CannotSplitCategory)
+	}
+	if len(children) == 0 {
+		return nil, errors.New(NoChildren)
+	}
+	children = append([]NewChild{}, children...)
+	for idx := range children {
+		if err = tidyTitle(&children[idx].Title); err != nil {
+			return
+		}
+		if err = tidyDesc(&children[idx].Desc); err != nil {
+			return
+		}
+		if err = api.checkUniqueTitle(skillId, -1,
+			children[idx].Title); err != nil {
+			return
+		}
+		for _, earlier := range children[:idx] {
+			if strings.EqualFold(earlier.Title, children[idx].Title) {
+				return nil, errors.New(DuplicateTitle)
+			}
+		}
+	}
+	assignments := map[string]int{}
+	for email, childIdx := range reassign {
+		if err = api.tweakParams(&email, nil); err != nil {
+			return
+		}
+		if api.SkillHoldings.holds(skillId, email) == false {
+			return nil, errors.New(NotHeld)
+		}
+		if childIdx < 0 || childIdx >= len(children) {
+			return nil, errors.New(UnknownChild)
+		}
+		assignments[email] = childIdx
+	}
+
+	split := api.startSplit(skill, actor)
+	uids = []int{}
+	for _, child := range children {
+		var uid int
+		uid, err = api.AddSkill(actor, Skill, child.Title, child.Desc, skillId)
+		if err != nil {
+			// Should not happen having passed the checks above.
+			split.abandon(uids)
+			return nil, err
+		}
+		uids = append(uids, uid)
+	}
+	api.notifyCreator(actor, skill, Split)
+	holders := split.holders
+	for _, email := range holders {
+		if childIdx, ok := assignments[email]; ok {
+			api.SkillHoldings.bind(uids[childIdx], email)
+		} else {
+			api.UiStates[email].NeedsReview.Add(skillId)
+		}
+	}
+	api.history.conflict(append([]int{skillId}, uids...))
+	return
+}
+
+/*
+The SetSkillRole() method changes the role of the given skill between Skill and
+Category. A Category can only become a Skill when it has no children. A Skill
+that people hold can only become a Category when reviewHolders is true, in
+which case the people who held it are marked as needing to review it (see
+SplitSkill()). Setting the role a skill has already is harmless. Only an admin
+(the actor) may do this, and the skill's creator is notified. Errors:
+PermissionDenied, UnknownSkill, UnknownRole, CannotChangeRoleWithChildren,
+CannotChangeRoleSkillHeld.
+*/
+func (api *Api) SetSkillRole(actor string, skillId int, role string,
+	reviewHolders bool) (err error) {
+	if err = api.requireAdmin(&actor); err != nil {
+		return
+	}
 	if err = api.tweakParams(nil, &skillId); err != nil {
 		return
 	}
-	// The order of the following tests makes it easier to design tests.
-	if skillId == api.SkillRoot {
-		err = errors.New(CannotRemoveRootSkill)
+	if role != Skill && role != Category {
+		return errors.New(UnknownRole)
+	}
+	skill := api.skillFromId[skillId]
+	if role == skill.Role {
 		return
 	}
-	departingSkill := api.skillFromId[skillId]
-	if len(departingSkill.Children) != 0 {
-		err = errors.New(CannotRemoveSkillWithChildren)
+	held := len(api.SkillHoldings.PeopleWithSkill[skillId].AsSlice()) != 0
+	if role == Skill && len(skill.Children) != 0 {
+		return errors.New(CannotChangeRoleWithChildren)
+	}
+	if role == Category && held && reviewHolders == false {
+		return errors.New(CannotChangeRoleSkillHeld)
+	}
+	api.history.conflict([]int{skillId})
+	if role == Skill {
+		api.notifyCreator(actor, skill, MadeSkill)
+		skill.Role = Skill
+		// Nobody needs to review a category that is no more.
+		for _, uiState := range api.UiStates {
+			uiState.NeedsReview.RemoveIfPresent(skillId)
+		}
+	} else {
+		api.notifyCreator(actor, skill, MadeCategory)
+		for _, email := range api.makeCategory(skill) {
+			api.UiStates[email].NeedsReview.Add(skillId)
+		}
+	}
+	skill.Editor = actor
+	return
+}
+
+/*
+The method NeedsReview() provides the Uids of the split skills (see
+SplitSkill()) that the given person needs to review, in ascending order. Can
+generate the UnknownPerson error.
+*/
+func (api *Api) NeedsReview(email string) (skills []int, err error) {
+	if err = api.tweakParams(&email, nil); err != nil {
 		return
 	}
-	if len(api.SkillHoldings.PeopleWithSkill[skillId].AsSlice()) != 0 {
-		err = errors.New(CannotRemoveSkillHeld)
+	skills = append([]int{}, api.UiStates[email].NeedsReview.AsSlice()...)
+	sort.Ints(skills)
+	return
+}
+
+/*
+The method DismissReview() settles the given person's review of the given
+split skill, without them picking any of its children - for when none of them
+apply. Dismissing a review that is not needed is harmless. Can generate the
+errors: UnknownPerson, UnknownSkill.
+*/
+func (api *Api) DismissReview(email string, skillId int) (err error) {
+	if err = api.tweakParams(&email, &skillId); err != nil {
 		return
 	}
+	api.UiStates[email].NeedsReview.RemoveIfPresent(skillId)
+	return
+}
 
-	parentSkill := api.skillFromId[departingSkill.Parent]
-	parentSkill.removeChild(skillId)
-	oldList := api.Skills
-	api.Skills = []*skillNode{}
-	for _, incumbentSkill := range oldList {
-		if incumbentSkill != departingSkill {
-			api.Skills = append(api.Skills, incumbentSkill)
+//--------------------------------------------------------------------------
+// Methods For Managing Roles
+//--------------------------------------------------------------------------
+
+/*
+The method GrantAdmin() gives the given person the Admin role. Only an admin
+(the actor) may do this - except while the model has no admins at all, when
+the first admin may be appointed by anybody. (This is how a new model gets its
+first admin, so callers must only rely on it at setup time.) Granting the role
+to somebody who has it already is harmless. Errors: PermissionDenied,
+UnknownPerson.
+*/
+func (api *Api) GrantAdmin(actor string, email string) (err error) {
+	if len(api.Admins()) != 0 {
+		if err = api.requireAdmin(&actor); err != nil {
+			return
 		}
 	}
-	delete(api.skillFromId, skillId)
-	// For all people, remove this skillid from their collapsed nodes
-	for _, skillHolder := range api.People {
-		api.UiStates[skillHolder.Email].NotifySkillIsRemoved(skillId)
+	if err = api.tweakParams(&email, nil); err != nil {
+		return
+	}
+	api.persFromMail[email].Role = Admin
+	return
+}
+
+/*
+The method RevokeAdmin() returns the given person to the User role. Only an
+admin (the actor) may do this, and the last admin cannot be revoked, so that
+the model is never left without one. Revoking the role from somebody who does
+not have it is harmless. Errors: PermissionDenied, UnknownPerson, LastAdmin.
+*/
+func (api *Api) RevokeAdmin(actor string, email string) (err error) {
+	if err = api.requireAdmin(&actor); err != nil {
+		return
+	}
+	if err = api.tweakParams(&email, nil); err != nil {
+		return
+	}
+	if err = api.checkNotLastAdmin(email); err != nil {
+		return
+	}
+	api.persFromMail[email].Role = User
+	return
+}
+
+/*
+The method IsAdmin() returns true if the given person is registered and has
+the Admin role. The email you provide is normalised before it is used.
+*/
+func (api *Api) IsAdmin(email string) bool {
+	if api.tweakParams(&email, nil) != nil {
+		return false
+	}
+	return api.persFromMail[email].Role == Admin
+}
+
+// The method Admins() provides the emails of the people with the Admin role,
+// in the order they were added to the model.
+func (api *Api) Admins() (emails []string) {
+	emails = []string{}
+	for _, person := range api.People {
+		if person.Role == Admin {
+			emails = append(emails, person.Email)
+		}
 	}
-	api.SkillHoldings.UnRegisterSkill(*departingSkill)
 	return
 }
 
@@ -409,6 +1251,62 @@ func (api *Api) Serialize() (out []byte, err error) {
 	return yaml.Marshal(api)
 }
 
+/*
+The function SerializeJSON() is like Serialize(), but makes JSON instead of
+YAML - for clients that prefer it. The JSON has the same structure and field
+names as the YAML, so that de-serializing either and serializing the result in
+the other form gives exactly what the other form would have. See also
+NewFromSerializedJSON().
+*/
+func (api *Api) SerializeJSON() (out []byte, err error) {
+	return json.Marshal(api)
+}
+
+/*
+The method Verify() checks the integrity of the model, by checking that the
+data it holds more than once agrees with itself - for example that a skill's
+parent lists it as a child, that every skill can be reached from the root,
+that skill holdings are the same in both directions and are not of categories,
+and that the next skill Uid is not already in use. It returns a description of
+each problem found, and so returns nothing when the model is sound. When repair
+is true, the problems are also put right (see verify.go for how). Problems are
+described in a repeatable order.
+*/
+func (api *Api) Verify(repair bool) (problems []string) {
+	checker := &integrityChecker{api: api, repair: repair}
+	checker.checkSkills()
+	checker.checkRoot()
+	checker.checkChildren()
+	checker.checkParents()
+	checker.checkReachable()
+	checker.checkNextSkill()
+	checker.checkPeople()
+	checker.checkHoldings()
+	if repair && len(checker.problems) != 0 {
+		api.search = newSearchIndex()
+		for _, skill := range api.Skills {
+			api.search.index(skill)
+		}
+	}
+	return append([]string{}, checker.problems...)
+}
+
+/*
+The method finishLoad() completes the building of an Api from de-serialized
+content, fills in the sets it left out (see applyDefaults()), and repairs it
+(see Verify()). Generates the Unrepairable error if
+any problems remain, since the Api cannot then be relied on.
+*/
+func (api *Api) finishLoad() (err error) {
+	api.applyDefaults()
+	api.finishBuildFromDeSerialize()
+	api.repairs = api.Verify(true)
+	if len(api.Verify(false)) != 0 {
+		return errors.New(Unrepairable)
+	}
+	return
+}
+
 /*
 The function finishBuildFromDeSerialize() takes the state of an Api object that
 has been partly initialized from de-serialization, and builds the supplemental
@@ -416,10 +1314,18 @@ fields required. These are mainly look up tables for convenience and speed.
 */
 func (api *Api) finishBuildFromDeSerialize() {
 	for _, skill := range api.Skills {
+		if skill == nil {
+			continue // Verify() will deal with it
+		}
+		skill.mapper = api
 		uid := skill.Uid
 		api.skillFromId[uid] = skill
+		api.search.index(skill)
 	}
 	for _, person := range api.People {
+		if person == nil {
+			continue // Verify() will deal with it
+		}
 		email := person.Email
 		api.persFromMail[email] = person
 	}
@@ -431,14 +1337,18 @@ func (api *Api) finishBuildFromDeSerialize() {
 
 /*
 The method tweakParams(), receives either or both of an email and a skill Uid,
-and coerces the email when given into lowercase, and then ensures the email is
-one known to the model, and the skillUid is legitimate. It can return either
-of the errors: UnknownPerson or UnknownSkill.
+and normalises the email when given according to the identity policy, and then
+ensures the email is one known to the model, and the skillUid is legitimate. It
+can return either of the errors: UnknownPerson or UnknownSkill.
 */
 func (api *Api) tweakParams(email *string, skillId *int) (err error) {
 	if email != nil {
-		// coerce caller's email to lower case
-		*email = strings.ToLower(*email)
+		// normalise caller's email; one that is illegal cannot be known
+		name, policyErr := api.identity.normalise(*email)
+		if policyErr != nil {
+			return errors.New(UnknownPerson)
+		}
+		*email = name
 		_, ok := api.persFromMail[*email]
 		if !ok {
 			return errors.New(UnknownPerson)
@@ -453,6 +1363,174 @@ func (api *Api) tweakParams(email *string, skillId *int) (err error) {
 	return
 }
 
+/*
+The method requireAdmin() generates the PermissionDenied error unless the given
+actor is a registered person with the Admin role. It normalises the actor's
+email in the same way as tweakParams().
+*/
+func (api *Api) requireAdmin(actor *string) (err error) {
+	if api.tweakParams(actor, nil) != nil ||
+		api.persFromMail[*actor].Role != Admin {
+		return errors.New(PermissionDenied)
+	}
+	return
+}
+
+/*
+The method checkReParent() makes the checks required before moving the toMove
+skill to the newParent. Moving a skill to one of its own descendants (or to
+itself) would detach it from the tree into a cycle, and is refused with the
+IllegalCycle error.
+*/
+func (api *Api) checkReParent(actor *string, toMove int, newParent int) (
+	err error) {
+	if err = api.requireAdmin(actor); err != nil {
+		return
+	}
+	if err = api.tweakParams(nil, &toMove); err != nil {
+		return
+	}
+	if err = api.tweakParams(nil, &newParent); err != nil {
+		return
+	}
+	if toMove == api.SkillRoot {
+		return errors.New(IllegalWithRoot)
+	}
+	newParentSkill := api.skillFromId[newParent]
+	if newParentSkill.Role != Category {
+		return errors.New(ParentNotCategory)
+	}
+	if err = api.checkUniqueTitle(newParent, toMove,
+		api.skillFromId[toMove].Title); err != nil {
+		return
+	}
+	treeOps := &skillTreeOps{api}
+	lineage := []*skillNode{}
+	treeOps.lineageOf(newParentSkill, &lineage)
+	for _, ancestor := range lineage {
+		if ancestor.Uid == toMove {
+			return errors.New(IllegalCycle)
+		}
+	}
+	return
+}
+
+/*
+The method makeCategory() changes the role of the given Skill to Category.
+Since nobody can hold a Category, the people who held it no longer do, and
+they are returned.
+*/
+func (api *Api) makeCategory(skill *skillNode) (holders []string) {
+	holders = api.SkillHoldings.PeopleWithSkill[skill.Uid].AsSlice()
+	for _, email := range holders {
+		api.SkillHoldings.unbind(skill.Uid, email)
+	}
+	skill.Role = Category
+	return
+}
+
+/*
+The splitState type records what SplitSkill() has changed about the skill
+being split, before its children are added, so that the split can be abandoned
+should adding them fail.
+*/
+type splitState struct {
+	api       *Api
+	skill     *skillNode
+	holders   []string
+	editor    string
+	nextSkill int
+}
+
+// The method startSplit() makes the given skill a Category (see
+// makeCategory()), edited by the actor, and records how to put it back.
+func (api *Api) startSplit(skill *skillNode, actor string) (
+	split *splitState) {
+	split = &splitState{api: api, skill: skill, editor: skill.Editor,
+		nextSkill: api.NextSkill}
+	split.holders = api.makeCategory(skill)
+	skill.Editor = actor
+	return
+}
+
+/*
+The method abandon() puts the skill back as it was before startSplit(),
+removing the children with the given Uids that had already been added, and
+giving the skill back to the people who held it. NextSkill is restored too, so
+that the Uids generated stay the same as on replay, where the failed split is
+not seen.
+*/
+func (split *splitState) abandon(children []int) {
+	api := split.api
+	for _, uid := range children {
+		api.removeSkillNode(api.skillFromId[uid])
+	}
+	api.history.conflict(children)
+	api.NextSkill = split.nextSkill
+	split.skill.Role = Skill
+	split.skill.Editor = split.editor
+	for _, email := range split.holders {
+		api.SkillHoldings.bind(split.skill.Uid, email)
+	}
+}
+
+/*
+The method removeSkillNode() removes all traces of the given skill from the
+model. The caller is responsible for checking that this is allowed, and that
+the skill has no children.
+*/
+func (api *Api) removeSkillNode(departingSkill *skillNode) {
+	skillId := departingSkill.Uid
+	parentSkill := api.skillFromId[departingSkill.Parent]
+	parentSkill.removeChild(skillId)
+	oldList := api.Skills
+	api.Skills = []*skillNode{}
+	for _, incumbentSkill := range oldList {
+		if incumbentSkill != departingSkill {
+			api.Skills = append(api.Skills, incumbentSkill)
+		}
+	}
+	delete(api.skillFromId, skillId)
+	api.search.unindex(skillId)
+	// For all people, remove this skillid from their collapsed nodes
+	for _, skillHolder := range api.People {
+		api.UiStates[skillHolder.Email].NotifySkillIsRemoved(skillId)
+	}
+	api.SkillHoldings.UnRegisterSkill(*departingSkill)
+}
+
+/*
+The method notifyCreator() queues a notification of the given change to the
+given skill for the skill's creator - unless the creator made the change
+themself, is not known, or is no longer registered.
+*/
+func (api *Api) notifyCreator(actor string, skill *skillNode, change string) {
+	creator := skill.Creator
+	if creator == "" || creator == actor {
+		return
+	}
+	if _, ok := api.persFromMail[creator]; !ok {
+		return
+	}
+	api.notifications = append(api.notifications, Notification{
+		To:     creator,
+		Actor:  actor,
+		Skill:  skill.Uid,
+		Title:  skill.Title,
+		Change: change,
+	})
+}
+
+// The method checkNotLastAdmin() generates the LastAdmin error if the given
+// (normalised) person is the only admin.
+func (api *Api) checkNotLastAdmin(email string) (err error) {
+	admins := api.Admins()
+	if len(admins) == 1 && admins[0] == email {
+		return errors.New(LastAdmin)
+	}
+	return
+}
+
 // The method titleFromId() exists to satisfy the titleMapper interface.
 func (api *Api) titleFromId(skillUid int) (title string) {
 	return api.skillFromId[skillUid].Title
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"github.com/peterhoward42/skilldrill/util/testutil"
 	"sort"
 	"strings"
@@ -33,15 +34,15 @@ func TestAddPersonDuplicate(t *testing.T) {
 
 func TestAddSkillUnknownParent(t *testing.T) {
 	api := buildSimpleModel(t)
-	_, err := api.AddSkill(Skill, "title", "desc", 99999)
+	_, err := api.AddSkill("", Skill, "title", "desc", 99999)
 	testutil.AssertErrGenerated(t, err, UnknownParent,
 		"Adding skill to unknown parent")
 }
 
 func TestAddSkillToNonCategory(t *testing.T) {
 	api := NewApi()
-	rootUid, _ := api.AddSkill(Skill, "", "", 99999)
-	_, err := api.AddSkill(Skill, "", "", rootUid)
+	rootUid, _ := api.AddSkill("", Skill, "A title", "", 99999)
+	_, err := api.AddSkill("", Skill, "B title", "", rootUid)
 	testutil.AssertErrGenerated(t, err, ParentNotCategory,
 		"Adding skill to non-category")
 }
@@ -63,13 +64,67 @@ func TestChildrenOrderedAlphabetically(t *testing.T) {
 		"Children are not sorted.")
 }
 
+func TestChildrenReorderedOnRename(t *testing.T) {
+	api := buildSimpleModel(t)
+	api.SetSkillTitle("fred.bloggs", 2, "A0")
+	testutil.AssertEqSliceInt(t, api.skillFromId[1].Children, []int{2, 3},
+		"Children re-sorted")
+
+	// Siblings that share a title (as old data may) are both kept.
+	api.skillFromId[2].Title = "AA"
+	api.skillFromId[1].sortChildren()
+	testutil.AssertEqSliceInt(t, api.skillFromId[1].Children, []int{2, 3},
+		"Same titles kept")
+}
+
+func TestSkillWordingRules(t *testing.T) {
+	api := buildAdminModel(t)
+
+	// Wording is trimmed.
+	skillId, err := api.AddSkill("", Skill, "  AAB ", " AAB desc\n", 3)
+	testutil.AssertNilErr(t, err, "Add trimmed")
+	title, desc, _, _, _ := api.SkillWording(skillId)
+	testutil.AssertEqString(t, title, "AAB", "Title trimmed")
+	testutil.AssertEqString(t, desc, "AAB desc", "Desc trimmed")
+
+	// Every write path applies the rules.
+	_, err = api.AddSkill("", Skill, " ", "", 3)
+	testutil.AssertErrGenerated(t, err, EmptyTitle, "Add empty title")
+	_, err = api.AddSkill("", Skill, strings.Repeat("X", 40), "", 3)
+	testutil.AssertErrGenerated(t, err, TooLong, "Add long title")
+	_, err = api.AddSkill("", Skill, "x", strings.Repeat("X", 500), 3)
+	testutil.AssertErrGenerated(t, err, TooLong, "Add long desc")
+	_, err = api.AddSkill("", Skill, "aaa", "", 3)
+	testutil.AssertErrGenerated(t, err, DuplicateTitle, "Add duplicate")
+	err = api.SetSkillTitle(admin, skillId, "")
+	testutil.AssertErrGenerated(t, err, EmptyTitle, "Rename empty")
+	err = api.SetSkillTitle(admin, skillId, "x\r\nBcc: a@b.c")
+	testutil.AssertErrGenerated(t, err, IllegalTitle, "Rename line break")
+	_, err = api.AddSkill("", Skill, "x\ty", "", 3)
+	testutil.AssertErrGenerated(t, err, IllegalTitle, "Add with tab")
+	err = api.SetSkillTitle(admin, skillId, "AAA")
+	testutil.AssertErrGenerated(t, err, DuplicateTitle, "Rename duplicate")
+	err = api.SetSkillTitle(admin, skillId, "aab")
+	testutil.AssertNilErr(t, err, "Rename to own title")
+	moved, _ := api.AddSkill("", Skill, "AAA", "", 2)
+	err = api.ReParentSkill(admin, moved, 3)
+	testutil.AssertErrGenerated(t, err, DuplicateTitle, "Move duplicate")
+	api.SetSkillRole(admin, moved, Category, false)
+	api.AddSkill("", Skill, "AAB", "", moved)
+	err = api.MergeSkills(admin, 3, moved)
+	testutil.AssertErrGenerated(t, err, DuplicateTitle, "Merge duplicate")
+	_, err = api.SplitSkill(admin, 4,
+		[]NewChild{{"AAAA", ""}, {"aaaa ", ""}}, nil)
+	testutil.AssertErrGenerated(t, err, DuplicateTitle, "Split duplicate")
+}
+
 //-----------------------------------------------------------------------------
 // Give a person a skill - delibarately stimulating errors
 //-----------------------------------------------------------------------------
 
 func TestBestowSkillToSpuriousPerson(t *testing.T) {
 	api := NewApi()
-	skill, _ := api.AddSkill(Skill, "", "", -1)
+	skill, _ := api.AddSkill("", Skill, "A title", "", -1)
 	err := api.GivePersonSkill("nosuch.person", skill)
 	testutil.AssertErrGenerated(t, err, UnknownPerson,
 		"Bestow skill to unknown person")
@@ -85,21 +140,134 @@ func TestBestowSpuriousSkillToPerson(t *testing.T) {
 
 func TestBestowCategorySkill(t *testing.T) {
 	api := NewApi()
-	skill, _ := api.AddSkill(Category, "", "", -1)
+	skill, _ := api.AddSkill("", Category, "A title", "", -1)
 	api.AddPerson("fred.bloggs")
 	err := api.GivePersonSkill("fred.bloggs", skill)
 	testutil.AssertErrGenerated(t, err, CannotBestowCategory,
 		"Give someone a category not a skill")
 }
 
+func TestRemovePersonSkill(t *testing.T) {
+	api := buildSimpleModel(t)
+	err := api.RemovePersonSkill("fred.bloggs", 4)
+	testutil.AssertNilErr(t, err, "Remove person skill")
+	hasSkill, _ := api.PersonHasSkill("fred.bloggs", 4)
+	testutil.AssertFalse(t, hasSkill, "Remove person skill")
+	// Check both directions of the holdings were updated
+	emails, _ := api.PeopleWithSkill(4)
+	testutil.AssertEqInt(t, len(emails), 0, "Remove person skill")
+	testutil.AssertFalse(t,
+		api.SkillHoldings.SkillsOfPerson["fred.bloggs"].Contains(4),
+		"Remove person skill")
+
+	err = api.RemovePersonSkill("fred.bloggs", 4)
+	testutil.AssertErrGenerated(t, err, NotHeld, "Remove person skill")
+	err = api.RemovePersonSkill("nosuch.person", 4)
+	testutil.AssertErrGenerated(t, err, UnknownPerson, "Remove person skill")
+	err = api.RemovePersonSkill("fred.bloggs", 999)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "Remove person skill")
+	err = api.RemovePersonSkill("fred.bloggs", 1)
+	testutil.AssertErrGenerated(t, err, CannotBestowCategory,
+		"Remove person skill")
+}
+
+func TestTogglePersonSkill(t *testing.T) {
+	api := buildSimpleModel(t)
+	hasSkill, err := api.TogglePersonSkill("John.Smith", 4)
+	testutil.AssertNilErr(t, err, "Toggle person skill")
+	testutil.AssertTrue(t, hasSkill, "Toggle person skill")
+	emails, _ := api.PeopleWithSkill(4)
+	testutil.AssertEqInt(t, len(emails), 2, "Toggle person skill")
+
+	hasSkill, err = api.TogglePersonSkill("john.smith", 4)
+	testutil.AssertNilErr(t, err, "Toggle person skill")
+	testutil.AssertFalse(t, hasSkill, "Toggle person skill")
+	emails, _ = api.PeopleWithSkill(4)
+	testutil.AssertEqSliceString(t, emails, []string{"fred.bloggs"},
+		"Toggle person skill")
+
+	_, err = api.TogglePersonSkill("john.smith", 1)
+	testutil.AssertErrGenerated(t, err, CannotBestowCategory,
+		"Toggle person skill")
+}
+
 func TestEmailsAreLowerCased(t *testing.T) {
 	api := NewApi()
-	skill, _ := api.AddSkill(Skill, "", "", -1)
+	skill, _ := api.AddSkill("", Skill, "A title", "", -1)
 	api.AddPerson("fred.bloggs")
 	// Note email address differs with upper case to that used to register
 	// the person.
 	err := api.GivePersonSkill("fred.Bloggs", skill)
 	testutil.AssertNilErr(t, err, "Using uppercase in email.")
+	testutil.AssertTrue(t, api.PersonExists("Fred.Bloggs"),
+		"Using uppercase in email.")
+}
+
+func TestIdentityPolicy(t *testing.T) {
+	api := NewApi()
+	policy := NewIdentityPolicy("Example.com")
+	err := policy.AddAlias("fbloggs", "fred.bloggs@example.com")
+	testutil.AssertNilErr(t, err, "Add alias")
+	api.SetIdentityPolicy(policy)
+
+	err = api.AddPerson("Fred.Bloggs@example.com")
+	testutil.AssertNilErr(t, err, "Add person with domain")
+	testutil.AssertTrue(t, api.PersonExists("fred.bloggs"),
+		"Domain is stripped")
+	testutil.AssertTrue(t, api.PersonExists("FBloggs@example.com"),
+		"Alias is resolved")
+	address, _ := policy.Address("fred.bloggs")
+	testutil.AssertEqString(t, address, "fred.bloggs@example.com",
+		"Address from name")
+
+	// The same person must not be added twice under different spellings.
+	err = api.AddPerson("fbloggs")
+	testutil.AssertErrGenerated(t, err, PersonExists, "Add person by alias")
+	err = api.AddPerson(" fred.bloggs ")
+	testutil.AssertErrGenerated(t, err, PersonExists,
+		"Add person with whitespace")
+
+	err = api.AddPerson("fred.bloggs@elsewhere.com")
+	testutil.AssertErrGenerated(t, err, WrongDomain, "Add person wrong domain")
+	err = api.AddPerson("fred bloggs")
+	testutil.AssertErrGenerated(t, err, IllegalEmail,
+		"Add person illegal characters")
+	err = api.AddPerson("fred..bloggs")
+	testutil.AssertErrGenerated(t, err, IllegalEmail, "Add person empty part")
+
+	// Elsewhere an illegal email is simply one that is not known.
+	skill, _ := api.AddSkill("", Skill, "A title", "", -1)
+	err = api.GivePersonSkill("fred.bloggs@elsewhere.com", skill)
+	testutil.AssertErrGenerated(t, err, UnknownPerson,
+		"Give skill to wrong domain")
+	err = api.GivePersonSkill("fbloggs", skill)
+	testutil.AssertNilErr(t, err, "Give skill via alias")
+
+	err = policy.AddAlias("fred.bloggs", "fbloggs")
+	testutil.AssertErrGenerated(t, err, AliasCycle, "Add alias to itself")
+}
+
+func TestEmailAddress(t *testing.T) {
+	api := NewApi()
+	policy := NewIdentityPolicy("example.com")
+	policy.AddAlias("fbloggs", "fred.bloggs")
+	api.SetIdentityPolicy(policy)
+
+	// Mail goes to the person the name stands for, not the address given.
+	name, address, err := api.EmailAddress("FBloggs@example.com")
+	testutil.AssertNilErr(t, err, "Address for alias")
+	testutil.AssertEqString(t, name, "fred.bloggs", "Name for alias")
+	testutil.AssertEqString(t, address, "fred.bloggs@example.com",
+		"Address for alias")
+	_, _, err = api.EmailAddress("fred.bloggs@elsewhere.com")
+	testutil.AssertErrGenerated(t, err, WrongDomain, "Address elsewhere")
+
+	// Without a domain, any domain is stripped, so nowhere is safe to mail.
+	api.SetIdentityPolicy(NewIdentityPolicy(""))
+	_, _, err = api.EmailAddress("fred.bloggs@elsewhere.com")
+	testutil.AssertErrGenerated(t, err, NoDomain, "Address with no domain")
+	name, _ = api.NormaliseEmail("fred.bloggs@elsewhere.com")
+	testutil.AssertEqString(t, name, "fred.bloggs", "Domain stripped")
 }
 
 //-----------------------------------------------------------------------------
@@ -108,80 +276,247 @@ func TestEmailsAreLowerCased(t *testing.T) {
 
 func TestSkillEditsErrors(t *testing.T) {
 	api := NewApi()
-	skill, err := api.AddSkill(Skill, "Orig Title", "Orig desc.", -1)
+	api.AddPerson("fred.bloggs")
+	skill, err := api.AddSkill("", Skill, "Orig Title", "Orig desc.", -1)
 	testutil.AssertNilErr(t, err, "Adding skill")
 
-	err = api.SetSkillTitle(skill, "New Title")
+	err = api.SetSkillTitle("fred.bloggs", skill, "New Title")
 	testutil.AssertNilErr(t, err, "Setting skill title.")
 	testutil.AssertEqString(t, api.skillFromId[skill].Title, "New Title",
 		"Setting skill title")
 
-	err = api.SetSkillTitle(999, "who cares")
+	err = api.SetSkillTitle("fred.bloggs", 999, "who cares")
 	testutil.AssertErrGenerated(t, err, UnknownSkill, "Set skill title.")
-	err = api.SetSkillTitle(skill, strings.Repeat("X", 40))
+	err = api.SetSkillTitle("fred.bloggs", skill, strings.Repeat("X", 40))
 	testutil.AssertErrGenerated(t, err, TooLong, "Setting skill title.")
 
-	err = api.SetSkillDesc(skill, "New Desc")
+	err = api.SetSkillDesc("fred.bloggs", skill, "New Desc")
 	testutil.AssertNilErr(t, err, "Setting skill desc.")
 	testutil.AssertEqString(t, api.skillFromId[skill].Desc, "New Desc",
 		"Setting skill desc")
 
-	err = api.SetSkillDesc(999, "New Desc")
+	err = api.SetSkillDesc("fred.bloggs", 999, "New Desc")
 	testutil.AssertErrGenerated(t, err, UnknownSkill, "Set skill desc.")
-	err = api.SetSkillDesc(skill, strings.Repeat("X", 500))
+	err = api.SetSkillDesc("fred.bloggs", skill, strings.Repeat("X", 500))
 	testutil.AssertErrGenerated(t, err, TooLong, "Setting skill desc.")
+	err = api.SetSkillDesc("no such person", skill, "New Desc")
+	testutil.AssertErrGenerated(t, err, UnknownPerson, "Set skill desc.")
+}
+
+func TestSetSkillWording(t *testing.T) {
+	api := buildAdminModel(t)
+
+	// Neither is changed when either is wrong.
+	err := api.SetSkillWording(admin, 2, "ABC", strings.Repeat("X", 500))
+	testutil.AssertErrGenerated(t, err, TooLong, "Long description")
+	err = api.SetSkillWording(admin, 2, "AA", "New description")
+	testutil.AssertErrGenerated(t, err, DuplicateTitle, "Duplicate title")
+	title, desc, _, _, _ := api.SkillWording(2)
+	testutil.AssertEqString(t, title+"/"+desc, "AB/AB description",
+		"Unchanged")
+
+	// Both are changed, and undone, together.
+	err = api.SetSkillWording(admin, 2, "ABC", "New description")
+	testutil.AssertNilErr(t, err, "Set wording")
+	title, desc, _, _, _ = api.SkillWording(2)
+	testutil.AssertEqString(t, title+"/"+desc, "ABC/New description",
+		"Changed")
+	undo, _, _, _ := api.UndoState(admin)
+	testutil.AssertEqString(t, undo, "rewording of ABC", "One edit")
+	api.Undo(admin)
+	title, desc, _, _, _ = api.SkillWording(2)
+	testutil.AssertEqString(t, title+"/"+desc, "AB/AB description",
+		"Undone together")
+	err = api.Undo(admin)
+	testutil.AssertErrGenerated(t, err, NothingToUndo, "Nothing else")
+
+	// Only what changes is recorded.
+	api.SetSkillWording(admin, 2, "AB", "Other description")
+	undo, _, _, _ = api.UndoState(admin)
+	testutil.AssertEqString(t, undo, "description change of AB",
+		"Description only")
+}
+
+func TestSkillAuthorsAndNotifications(t *testing.T) {
+	api := buildAdminModel(t)
+	creator, editor, err := api.SkillAuthors(4)
+	testutil.AssertNilErr(t, err, "Skill authors")
+	testutil.AssertEqString(t, creator, "fred.bloggs", "Creator")
+	testutil.AssertEqString(t, editor, "fred.bloggs", "Editor")
+	_, _, err = api.SkillAuthors(999)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "Skill authors")
+
+	// Changes by the creator themself, or that change nothing, are quiet.
+	api.SetSkillTitle("Fred.Bloggs", 4, "AAA renamed")
+	api.SetSkillDesc(admin, 4, "AAA description")
+	testutil.AssertEqInt(t, len(api.TakeNotifications()), 0,
+		"No notifications")
+
+	api.SetSkillDesc(admin, 4, "AAA redescribed")
+	_, editor, _ = api.SkillAuthors(4)
+	testutil.AssertEqString(t, editor, admin, "Editor")
+	api.ReParentSkill(admin, 3, 2)
+	api.GivePersonSkill("fred.bloggs", 4) // no notification
+	notifications := api.TakeNotifications()
+	testutil.AssertEqInt(t, len(notifications), 2, "Notifications")
+	testutil.AssertEqString(t, notifications[0].To, "fred.bloggs", "To")
+	testutil.AssertEqString(t, notifications[0].Actor, admin, "Actor")
+	testutil.AssertEqString(t, notifications[0].Title, "AAA renamed",
+		"Title")
+	testutil.AssertEqString(t, notifications[0].Change, Redescribed,
+		"Change")
+	// A move notifies the creators of the moved skill and its descendants,
+	// but only once each (Fred created both AA and AAA).
+	testutil.AssertEqInt(t, notifications[1].Skill, 3, "Moved skill")
+	testutil.AssertEqString(t, notifications[1].Change, Moved, "Change")
+	testutil.AssertEqInt(t, len(api.TakeNotifications()), 0, "Queue empty")
+
+	// Creators who have left are not notified.
+	api.RemovePerson(admin, "fred.bloggs")
+	api.RemoveSkill(admin, 4)
+	testutil.AssertEqInt(t, len(api.TakeNotifications()), 0,
+		"Creator removed")
 }
 
 func TestMoveSkillInTree(t *testing.T) {
-	api := buildSimpleModel(t)
-	err := api.ReParentSkill(4, 1)
+	api := buildAdminModel(t)
+	err := api.ReParentSkill(admin, 4, 1)
 	testutil.AssertNilErr(t, err, "Re parenting skill")
 	testutil.AssertEqSliceInt(t, api.skillFromId[1].Children,
 		[]int{3, 4, 2}, "Re parenting skill")
 	testutil.AssertEqInt(t, api.skillFromId[4].Parent, 1,
 		"Re parenting skill")
 
-	err = api.ReParentSkill(4, 999)
+	err = api.ReParentSkill(admin, 4, 999)
 	testutil.AssertErrGenerated(t, err, UnknownSkill, "Re parenting skill")
-	err = api.ReParentSkill(999, 1)
+	err = api.ReParentSkill(admin, 999, 1)
 	testutil.AssertErrGenerated(t, err, UnknownSkill, "Re parenting skill")
 
-	err = api.ReParentSkill(1, 4)
+	err = api.ReParentSkill(admin, 1, 4)
 	testutil.AssertErrGenerated(t, err, IllegalWithRoot, "Re parenting skill")
 
-	api = buildSimpleModel(t)
-	err = api.ReParentSkill(3, 4)
+	api = buildAdminModel(t)
+	err = api.ReParentSkill(admin, 3, 4)
 	testutil.AssertErrGenerated(t, err, ParentNotCategory, "Re parenting skill")
 }
 
+func TestMoveSkillIntoItself(t *testing.T) {
+	api := buildAdminModel(t)
+	skillAAB, _ := api.AddSkill("", Category, "AAB", "AAB description", 3)
+	err := api.ReParentSkill(admin, 3, skillAAB)
+	testutil.AssertErrGenerated(t, err, IllegalCycle, "Move into descendant")
+	err = api.ReParentSkill(admin, 3, 3)
+	testutil.AssertErrGenerated(t, err, IllegalCycle, "Move into itself")
+	skills, _ := api.EnumerateWholeTree()
+	testutil.AssertEqSliceInt(t, skills, []int{1, 3, 4, skillAAB, 2},
+		"Tree is unchanged")
+}
+
+func TestPreviewMoveSkill(t *testing.T) {
+	api := buildAdminModel(t)
+	api.GivePersonSkill("john.smith", 4)
+	skills, holders, err := api.PreviewReParentSkill(admin, 3, 2)
+	testutil.AssertNilErr(t, err, "Preview move")
+	testutil.AssertEqSliceInt(t, skills, []int{3, 4}, "Skills affected")
+	testutil.AssertEqSliceString(t, holders,
+		[]string{"fred.bloggs", "john.smith"}, "Holders affected")
+	testutil.AssertEqInt(t, api.skillFromId[3].Parent, 1, "Nothing moved")
+
+	_, holders, err = api.PreviewReParentSkill(admin, 2, 3)
+	testutil.AssertNilErr(t, err, "Preview move")
+	testutil.AssertEqSliceString(t, holders, []string{}, "No holders")
+	_, _, err = api.PreviewReParentSkill(admin, 1, 3)
+	testutil.AssertErrGenerated(t, err, IllegalWithRoot, "Preview move root")
+	_, _, err = api.PreviewReParentSkill("fred.bloggs", 3, 2)
+	testutil.AssertErrGenerated(t, err, PermissionDenied, "Preview as user")
+}
+
 func TestRemovePerson(t *testing.T) {
-	api := buildSimpleModel(t)
-	err := api.RemovePerson("fred.bloggs")
+	api := buildAdminModel(t)
+	err := api.RemovePerson(admin, "fred.bloggs")
 	testutil.AssertNilErr(t, err, "Remove Person")
 	testutil.AssertFalse(t, api.PersonExists("fred.bloggs"), "Remove Person")
-	err = api.RemovePerson("no suchperson")
+	err = api.RemovePerson(admin, "no suchperson")
 	testutil.AssertErrGenerated(t, err, UnknownPerson, "Remove Person")
 }
 
-func TestRemoveSkill(t *testing.T) {
+func TestAdminOnlyOperations(t *testing.T) {
+	api := buildAdminModel(t)
+	err := api.ReParentSkill("fred.bloggs", 4, 1)
+	testutil.AssertErrGenerated(t, err, PermissionDenied, "Re parent as user")
+	err = api.RemoveSkill("fred.bloggs", 2)
+	testutil.AssertErrGenerated(t, err, PermissionDenied, "Remove as user")
+	err = api.RemovePerson("fred.bloggs", "john.smith")
+	testutil.AssertErrGenerated(t, err, PermissionDenied,
+		"Remove person as user")
+	err = api.RemoveSkill("no such person", 2)
+	testutil.AssertErrGenerated(t, err, PermissionDenied,
+		"Remove as unknown person")
+
+	// Operations that are open to everyone stay open.
+	_, err = api.AddSkill("", Skill, "AAB", "AAB description", 3)
+	testutil.AssertNilErr(t, err, "Add skill as anyone")
+	err = api.GivePersonSkill("fred.bloggs", 4)
+	testutil.AssertNilErr(t, err, "Give skill as user")
+}
+
+func TestManageAdmins(t *testing.T) {
 	api := buildSimpleModel(t)
+	testutil.AssertEqSliceString(t, api.Admins(), []string{}, "No admins")
+
+	// The first admin can be appointed by anybody.
+	err := api.GrantAdmin("", "Fred.Bloggs")
+	testutil.AssertNilErr(t, err, "Appoint first admin")
+	testutil.AssertTrue(t, api.IsAdmin("fred.bloggs"), "Appoint first admin")
+	testutil.AssertFalse(t, api.IsAdmin("john.smith"), "Still a user")
+
+	// But after that, only by an admin.
+	err = api.GrantAdmin("john.smith", "john.smith")
+	testutil.AssertErrGenerated(t, err, PermissionDenied, "Grant as user")
+	err = api.GrantAdmin("fred.bloggs", "john.smith")
+	testutil.AssertNilErr(t, err, "Grant as admin")
+	err = api.GrantAdmin("fred.bloggs", "no such person")
+	testutil.AssertErrGenerated(t, err, UnknownPerson, "Grant unknown")
+	testutil.AssertEqSliceString(t, api.Admins(),
+		[]string{"fred.bloggs", "john.smith"}, "Two admins")
+
+	err = api.RevokeAdmin("john.smith", "fred.bloggs")
+	testutil.AssertNilErr(t, err, "Revoke admin")
+	err = api.RevokeAdmin("fred.bloggs", "john.smith")
+	testutil.AssertErrGenerated(t, err, PermissionDenied, "Revoke as user")
+	err = api.RevokeAdmin("john.smith", "john.smith")
+	testutil.AssertErrGenerated(t, err, LastAdmin, "Revoke last admin")
+	err = api.RemovePerson("john.smith", "john.smith")
+	testutil.AssertErrGenerated(t, err, LastAdmin, "Remove last admin")
+
+	// Roles survive serialization.
+	serialized, err := api.Serialize()
+	testutil.AssertNilErr(t, err, "Serialize")
+	api, err = NewFromSerialized(serialized)
+	testutil.AssertNilErr(t, err, "DeSerialize")
+	testutil.AssertEqSliceString(t, api.Admins(), []string{"john.smith"},
+		"Admins after serialization")
+}
+
+func TestRemoveSkill(t *testing.T) {
+	api := buildAdminModel(t)
 
 	// Try to remove a skill with children
-	err := api.RemoveSkill(3)
+	err := api.RemoveSkill(admin, 3)
 	testutil.AssertErrGenerated(t, err, CannotRemoveSkillWithChildren,
 		"Remove Skill")
 
 	// Try to remove an unnkown skill
-	err = api.RemoveSkill(999)
+	err = api.RemoveSkill(admin, 999)
 	testutil.AssertErrGenerated(t, err, UnknownSkill, "Remove Skill")
 
 	// Try to remove the root skill
-	err = api.RemoveSkill(1)
+	err = api.RemoveSkill(admin, 1)
 	testutil.AssertErrGenerated(t, err, CannotRemoveRootSkill,
 		"Remove Skill")
 
 	// Try to remove a skill that has people registered agains it
-	err = api.RemoveSkill(4)
+	err = api.RemoveSkill(admin, 4)
 	testutil.AssertErrGenerated(t, err, CannotRemoveSkillHeld,
 		"Remove Skill")
 
@@ -190,7 +525,7 @@ func TestRemoveSkill(t *testing.T) {
 	// longer shows up in his collapsed skill node set.
 	err = api.CollapseSkill("john.smith", 2)
 	testutil.AssertNilErr(t, err, "Collapse Skill.")
-	err = api.RemoveSkill(2)
+	err = api.RemoveSkill(admin, 2)
 	testutil.AssertNilErr(t, err, "Remove Skill")
 
 	// Check that the skill that was removed has been forgotten in every way
@@ -202,10 +537,411 @@ func TestRemoveSkill(t *testing.T) {
 		api.UiStates["john.smith"].CollapsedNodes.Contains(2), "Remove Skill")
 }
 
+func TestUndoRedo(t *testing.T) {
+	api := buildAdminModel(t)
+	err := api.Undo(admin)
+	testutil.AssertErrGenerated(t, err, NothingToUndo, "Nothing to undo")
+	err = api.Redo(admin)
+	testutil.AssertErrGenerated(t, err, NothingToRedo, "Nothing to redo")
+
+	// Edit the description, rename and move AB, then undo them in turn.
+	api.SetSkillDesc(admin, 2, "New description")
+	api.SetSkillTitle(admin, 2, "ABC")
+	api.ReParentSkill(admin, 2, 3)
+	undo, redo, _, _ := api.UndoState(admin)
+	testutil.AssertEqString(t, undo, "move of ABC", "Undo state")
+	testutil.AssertEqString(t, redo, "", "Undo state")
+	err = api.Undo(admin)
+	testutil.AssertNilErr(t, err, "Undo move")
+	parent, _, _ := api.SkillRelations(2)
+	testutil.AssertEqInt(t, parent, 1, "Undo move")
+	api.Undo(admin)
+	api.Undo(admin)
+	title, desc, _, _, _ := api.SkillWording(2)
+	testutil.AssertEqString(t, title, "AB", "Undo rename")
+	testutil.AssertEqString(t, desc, "AB description", "Undo description")
+	testutil.AssertEqSliceInt(t, api.Search("abc"), []int{}, "Undo rename")
+
+	// Redo the description change, and a new edit empties the redo stack.
+	err = api.Redo(admin)
+	testutil.AssertNilErr(t, err, "Redo description")
+	_, desc, _, _, _ = api.SkillWording(2)
+	testutil.AssertEqString(t, desc, "New description", "Redo description")
+	api.SetSkillDesc(admin, 3, "AA changed")
+	_, redo, _, _ = api.UndoState(admin)
+	testutil.AssertEqString(t, redo, "", "Redo emptied")
+
+	// Remove AB, which the admin has collapsed, and undo that.
+	api.CollapseSkill(admin, 2)
+	skillsBefore := append([]*skillNode{}, api.Skills...)
+	api.RemoveSkill(admin, 2)
+	err = api.Undo(admin)
+	testutil.AssertNilErr(t, err, "Undo removal")
+	for idx, skill := range api.Skills {
+		testutil.AssertEqInt(t, skill.Uid, skillsBefore[idx].Uid,
+			"Restored in place")
+	}
+	_, children, _ := api.SkillRelations(1)
+	testutil.AssertEqSliceInt(t, children, []int{3, 2}, "Restored child")
+	collapsed, _ := api.IsCollapsed(admin, 2)
+	testutil.AssertTrue(t, collapsed, "Restored collapse state")
+	testutil.AssertEqInt(t, len(api.Verify(false)), 0, "Restored soundly")
+	err = api.Redo(admin)
+	testutil.AssertNilErr(t, err, "Redo removal")
+	_, _, _, err = api.SkillSummary(2)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "Redo removal")
+
+	// A person who is not an admin can undo adding a skill, but only an
+	// admin can undo a removal.
+	added, _ := api.AddSkill("fred.bloggs", Skill, "New", "", 3)
+	err = api.Undo("fred.bloggs")
+	testutil.AssertNilErr(t, err, "Undo add")
+	_, _, _, err = api.SkillSummary(added)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "Undo add")
+	err = api.Redo("fred.bloggs")
+	testutil.AssertNilErr(t, err, "Redo add")
+	creator, _, _ := api.SkillAuthors(added)
+	testutil.AssertEqString(t, creator, "fred.bloggs", "Redo add")
+	api.GivePersonSkill("fred.bloggs", added)
+	err = api.Undo("fred.bloggs")
+	testutil.AssertErrGenerated(t, err, CannotRemoveSkillHeld,
+		"Undo add of held skill")
+	api.RemovePersonSkill("fred.bloggs", added)
+	api.RemoveSkill(admin, added)
+	api.GrantAdmin(admin, "fred.bloggs")
+	api.RevokeAdmin("fred.bloggs", admin)
+	err = api.Undo(admin)
+	testutil.AssertErrGenerated(t, err, PermissionDenied,
+		"Undo removal by non admin")
+}
+
+func TestUndoInvalidation(t *testing.T) {
+	api := buildAdminModel(t)
+	api.AddPerson("jane.doe")
+	api.GrantAdmin(admin, "jane.doe")
+
+	// Somebody else's edit to the same skill makes the undo unsafe.
+	api.ReParentSkill(admin, 2, 3)
+	api.SetSkillDesc(admin, 4, "Changed")
+	api.ReParentSkill("jane.doe", 2, 1)
+	undo, _, _, _ := api.UndoState(admin)
+	testutil.AssertEqString(t, undo, "description change of AAA",
+		"Conflicting edit dropped")
+	api.Undo(admin)
+	err := api.Undo(admin)
+	testutil.AssertErrGenerated(t, err, NothingToUndo, "Conflicting edit")
+	parent, _, _ := api.SkillRelations(2)
+	testutil.AssertEqInt(t, parent, 1, "Move not undone")
+
+	// A person's own later edits do not, since they are undone first.
+	api.SetSkillTitle(admin, 2, "AB1")
+	api.SetSkillTitle(admin, 2, "AB2")
+	api.Undo(admin)
+	api.Undo(admin)
+	title, _, _, _, _ := api.SkillWording(2)
+	testutil.AssertEqString(t, title, "AB", "Own edits undone")
+
+	// Neither can anybody undo past a merge.
+	api.Redo(admin)
+	api.SetSkillDesc("jane.doe", 3, "Changed")
+	api.MergeSkills(admin, 3, 2)
+	_, redo, _, _ := api.UndoState(admin)
+	undo, _, _, _ = api.UndoState("jane.doe")
+	testutil.AssertEqString(t, undo+redo, "", "Merge conflicts")
+
+	// A person's history is limited, and is forgotten when they are.
+	for idx := 0; idx < MaxUndoDepth+5; idx++ {
+		api.SetSkillDesc("jane.doe", 4, fmt.Sprintf("Version %d", idx))
+	}
+	for err = nil; err == nil; {
+		err = api.Undo("jane.doe")
+	}
+	_, desc, _, _, _ := api.SkillWording(4)
+	testutil.AssertEqString(t, desc, "Version 4", "Depth limited")
+	api.RemovePerson(admin, "jane.doe")
+	api.AddPerson("jane.doe")
+	_, redo, _, _ = api.UndoState("jane.doe")
+	testutil.AssertEqString(t, redo, "", "Forgotten")
+}
+
+func TestUndoDropped(t *testing.T) {
+	api := buildAdminModel(t)
+	api.AddPerson("jane.doe")
+	api.GrantAdmin(admin, "jane.doe")
+
+	// Removing the parent that an edit relies on makes the undo unsafe.
+	api.SetSkillDesc(admin, 4, "Changed")
+	added, _ := api.AddSkill(admin, Skill, "New", "", 2)
+	api.ReParentSkill(admin, added, 3)
+	api.ReParentSkill(admin, added, 1)
+	api.RemoveSkill("jane.doe", 2)
+	undo, _, _, _ := api.UndoState(admin)
+	testutil.AssertEqString(t, undo, "move of New", "Parent removed")
+	api.Undo(admin)
+	undo, _, _, _ = api.UndoState(admin)
+	testutil.AssertEqString(t, undo, "description change of AAA",
+		"Edits relying on parent dropped")
+
+	// So is re-roling it, even when that fails.
+	api.SetSkillDesc(admin, 4, "Changed again")
+	err := api.SetSkillRole(admin, 3, Skill, false)
+	testutil.AssertErrGenerated(t, err, CannotChangeRoleWithChildren,
+		"Role change fails")
+	undo, _, _, _ = api.UndoState(admin)
+	testutil.AssertEqString(t, undo, "description change of AAA",
+		"Failed role change conflicts with nothing")
+
+	// An edit that can no longer be undone is dropped when it is tried,
+	// rather than blocking those beneath it.
+	api = buildAdminModel(t)
+	api.AddPerson("jane.doe")
+	api.GrantAdmin(admin, "jane.doe")
+	category, _ := api.AddSkill(admin, Category, "P", "", 2)
+	api.ReParentSkill(admin, 3, category)
+	api.ReParentSkill(admin, 3, 1)
+	api.ReParentSkill("jane.doe", 2, 3)
+	err = api.Undo(admin)
+	testutil.AssertNilErr(t, err, "Undo move into cycle")
+	parent, _, _ := api.SkillRelations(3)
+	testutil.AssertEqInt(t, parent, 1, "Move into cycle not undone")
+	undo, redo, dropped, _ := api.UndoState(admin)
+	testutil.AssertEqString(t, dropped, "move of AA ("+IllegalCycle+")",
+		"Dropped reported")
+	testutil.AssertEqString(t, undo, "move of AA", "Edit beneath")
+	testutil.AssertEqString(t, redo, "", "Dropped not redoable")
+	api.Undo(admin)
+	_, _, dropped, _ = api.UndoState(admin)
+	testutil.AssertEqString(t, dropped, "", "Dropped report cleared")
+}
+
 //-----------------------------------------------------------------------------
 // Exercise Queries
 //-----------------------------------------------------------------------------
 
+func TestMergeSkills(t *testing.T) {
+	api := buildAdminModel(t)
+	skillAAB, _ := api.AddSkill(admin, Skill, "AAB", "AAB description", 3)
+	api.GivePersonSkill("john.smith", skillAAB)
+	api.GivePersonSkill("fred.bloggs", skillAAB)
+	err := api.MergeSkills(admin, skillAAB, 4)
+	testutil.AssertNilErr(t, err, "Merge skills")
+	_, err = api.PeopleWithSkill(4)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "Absorbed skill gone")
+	holders, _ := api.PeopleWithSkill(skillAAB)
+	sort.Strings(holders)
+	testutil.AssertEqSliceString(t, holders,
+		[]string{"fred.bloggs", "john.smith"}, "Holders transferred")
+	aliases, _ := api.SkillAliases(skillAAB)
+	testutil.AssertEqSliceString(t, aliases, []string{"AAA"}, "Alias")
+	notifications := api.TakeNotifications()
+	testutil.AssertEqInt(t, len(notifications), 1, "Creator notified")
+	testutil.AssertEqString(t, notifications[0].Change, Merged, "Change")
+
+	// Merging categories moves the children and the collapsed state.
+	err = api.MergeSkills(admin, 2, 3)
+	testutil.AssertNilErr(t, err, "Merge categories")
+	skills, _, _ := api.EnumerateTree("fred.bloggs")
+	testutil.AssertEqSliceInt(t, skills, []int{1, 2}, "Collapsed moved")
+	skills, _ = api.EnumerateWholeTree()
+	testutil.AssertEqSliceInt(t, skills, []int{1, 2, skillAAB}, "Children")
+	aliases, _ = api.SkillAliases(2)
+	testutil.AssertEqSliceString(t, aliases, []string{"AA"}, "Alias")
+}
+
+func TestMergeSkillsErrors(t *testing.T) {
+	api := buildAdminModel(t)
+	err := api.MergeSkills("fred.bloggs", 2, 3)
+	testutil.AssertErrGenerated(t, err, PermissionDenied, "Merge as user")
+	err = api.MergeSkills(admin, 2, 999)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "Merge unknown")
+	err = api.MergeSkills(admin, 2, 2)
+	testutil.AssertErrGenerated(t, err, CannotMergeWithItself,
+		"Merge with itself")
+	err = api.MergeSkills(admin, 4, 2)
+	testutil.AssertErrGenerated(t, err, RoleMismatch, "Merge mismatch")
+	err = api.MergeSkills(admin, 2, 1)
+	testutil.AssertErrGenerated(t, err, IllegalWithRoot, "Merge root")
+	skillAAB, _ := api.AddSkill(admin, Category, "AAB", "AAB description", 3)
+	err = api.MergeSkills(admin, skillAAB, 3)
+	testutil.AssertErrGenerated(t, err, IllegalCycle, "Merge into child")
+}
+
+func TestSplitSkill(t *testing.T) {
+	api := buildAdminModel(t)
+	api.GivePersonSkill("john.smith", 4)
+	children := []NewChild{{"AAA2", "Second"}, {"AAA1", "First"}}
+	uids, err := api.SplitSkill(admin, 4, children,
+		map[string]int{"John.Smith": 1})
+	testutil.AssertNilErr(t, err, "Split skill")
+	testutil.AssertEqSliceInt(t, uids, []int{5, 6}, "New uids")
+	_, role, _, _ := api.SkillSummary(4)
+	testutil.AssertEqString(t, role, Category, "Split skill is a category")
+	skills, _ := api.EnumerateWholeTree()
+	testutil.AssertEqSliceInt(t, skills, []int{1, 3, 4, 6, 5, 2}, "Tree")
+
+	// John was reassigned, and Fred needs to review.
+	hasSkill, _ := api.PersonHasSkill("john.smith", 6)
+	testutil.AssertTrue(t, hasSkill, "Reassigned")
+	review, _ := api.NeedsReview("john.smith")
+	testutil.AssertEqSliceInt(t, review, []int{}, "No review")
+	review, _ = api.NeedsReview("fred.bloggs")
+	testutil.AssertEqSliceInt(t, review, []int{4}, "Needs review")
+	testutil.AssertEqInt(t, len(api.TakeNotifications()), 1,
+		"Creator notified")
+
+	// Picking one of the children settles the review.
+	err = api.GivePersonSkill("fred.bloggs", 5)
+	testutil.AssertNilErr(t, err, "Pick child")
+	review, _ = api.NeedsReview("fred.bloggs")
+	testutil.AssertEqSliceInt(t, review, []int{}, "Review settled")
+
+	// As does dismissing it.
+	api.SplitSkill(admin, 5, []NewChild{{"AAA2a", ""}}, nil)
+	review, _ = api.NeedsReview("fred.bloggs")
+	testutil.AssertEqSliceInt(t, review, []int{5}, "Needs review")
+	err = api.DismissReview("fred.bloggs", 5)
+	testutil.AssertNilErr(t, err, "Dismiss review")
+	review, _ = api.NeedsReview("fred.bloggs")
+	testutil.AssertEqSliceInt(t, review, []int{}, "Review dismissed")
+}
+
+func TestSplitSkillErrors(t *testing.T) {
+	api := buildAdminModel(t)
+	children := []NewChild{{"AAA1", "First"}}
+	_, err := api.SplitSkill("fred.bloggs", 4, children, nil)
+	testutil.AssertErrGenerated(t, err, PermissionDenied, "Split as user")
+	_, err = api.SplitSkill(admin, 3, children, nil)
+	testutil.AssertErrGenerated(t, err, CannotSplitCategory, "Split category")
+	_, err = api.SplitSkill(admin, 4, []NewChild{}, nil)
+	testutil.AssertErrGenerated(t, err, NoChildren, "Split into nothing")
+	_, err = api.SplitSkill(admin, 4,
+		[]NewChild{{strings.Repeat("X", 40), ""}}, nil)
+	testutil.AssertErrGenerated(t, err, TooLong, "Split title too long")
+	_, err = api.SplitSkill(admin, 4, children, map[string]int{"nobody": 0})
+	testutil.AssertErrGenerated(t, err, UnknownPerson, "Reassign unknown")
+	_, err = api.SplitSkill(admin, 4, children,
+		map[string]int{"john.smith": 0})
+	testutil.AssertErrGenerated(t, err, NotHeld, "Reassign non holder")
+	_, err = api.SplitSkill(admin, 4, children,
+		map[string]int{"fred.bloggs": 1})
+	testutil.AssertErrGenerated(t, err, UnknownChild, "Reassign to nothing")
+	_, role, _, _ := api.SkillSummary(4)
+	testutil.AssertEqString(t, role, Skill, "Nothing changed")
+}
+
+func TestSplitAbandoned(t *testing.T) {
+	api := buildAdminModel(t)
+	before, _ := api.Serialize()
+	split := api.startSplit(api.skillFromId[4], admin)
+	uid, err := api.AddSkill(admin, Skill, "AAA1", "", 4)
+	testutil.AssertNilErr(t, err, "Add first child")
+	split.abandon([]int{uid})
+	after, _ := api.Serialize()
+	testutil.AssertEqString(t, string(after), string(before), "Put back")
+	hasSkill, _ := api.PersonHasSkill("fred.bloggs", 4)
+	testutil.AssertTrue(t, hasSkill, "Holder kept")
+}
+
+func TestSetSkillRole(t *testing.T) {
+	api := buildAdminModel(t)
+	api.TakeNotifications()
+
+	// Make an empty category (AB) a skill, and give it to someone.
+	err := api.SetSkillRole(admin, 2, Skill, false)
+	testutil.AssertNilErr(t, err, "Category to skill")
+	_, role, _, _ := api.SkillSummary(2)
+	testutil.AssertEqString(t, role, Skill, "Category to skill")
+	err = api.GivePersonSkill("john.smith", 2)
+	testutil.AssertNilErr(t, err, "Give converted skill")
+
+	// And back again, asking its holder to review it.
+	err = api.SetSkillRole(admin, 2, Category, true)
+	testutil.AssertNilErr(t, err, "Skill to category")
+	_, role, _, _ = api.SkillSummary(2)
+	testutil.AssertEqString(t, role, Category, "Skill to category")
+	holders, _ := api.PeopleWithSkill(2)
+	testutil.AssertEqInt(t, len(holders), 0, "Holders unbound")
+	reviews, _ := api.NeedsReview("john.smith")
+	testutil.AssertEqSliceInt(t, reviews, []int{2}, "Holder asked to review")
+
+	// Setting the same role again is harmless.
+	err = api.SetSkillRole(admin, 2, Category, false)
+	testutil.AssertNilErr(t, err, "Same role")
+
+	// The creator hears about both changes.
+	notifications := api.TakeNotifications()
+	testutil.AssertEqInt(t, len(notifications), 2, "Creator notified")
+	testutil.AssertEqString(t, notifications[1].Change, MadeCategory,
+		"Creator notified")
+	_, editor, _ := api.SkillAuthors(2)
+	testutil.AssertEqString(t, editor, admin, "Editor recorded")
+}
+
+func TestSetSkillRoleErrors(t *testing.T) {
+	api := buildAdminModel(t)
+	err := api.SetSkillRole("fred.bloggs", 2, Skill, false)
+	testutil.AssertErrGenerated(t, err, PermissionDenied, "Set role as user")
+	err = api.SetSkillRole(admin, 999, Skill, false)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "Set role of nothing")
+	err = api.SetSkillRole(admin, 2, "XXX", false)
+	testutil.AssertErrGenerated(t, err, UnknownRole, "Set unknown role")
+	err = api.SetSkillRole(admin, 3, Skill, false)
+	testutil.AssertErrGenerated(t, err, CannotChangeRoleWithChildren,
+		"Category with children to skill")
+	err = api.SetSkillRole(admin, 4, Category, false)
+	testutil.AssertErrGenerated(t, err, CannotChangeRoleSkillHeld,
+		"Held skill to category")
+	_, role, _, _ := api.SkillSummary(4)
+	testutil.AssertEqString(t, role, Skill, "Nothing changed")
+}
+
+func TestSkillPaths(t *testing.T) {
+	api := buildSimpleModel(t)
+	slashed, _ := api.AddSkill("", Skill, "CI/CD", `Build \ deploy`, 3)
+	api.SetSkillTitle("fred.bloggs", slashed, `CI/CD\`)
+
+	path, err := api.SkillPath(4)
+	testutil.AssertNilErr(t, err, "Path of skill")
+	testutil.AssertEqString(t, path, "AA/AAA", "Path of skill")
+	path, _ = api.SkillPath(1)
+	testutil.AssertEqString(t, path, "", "Path of root")
+	path, _ = api.SkillPath(slashed)
+	testutil.AssertEqString(t, path, `AA/CI\/CD\\`, "Path escaped")
+	_, err = api.SkillPath(999)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "Path of nothing")
+
+	skillId, err := api.ResolvePath("aa/aaa")
+	testutil.AssertNilErr(t, err, "Resolve path")
+	testutil.AssertEqInt(t, skillId, 4, "Resolve path")
+	skillId, _ = api.ResolvePath(path)
+	testutil.AssertEqInt(t, skillId, slashed, "Resolve escaped path")
+	skillId, _ = api.ResolvePath("")
+	testutil.AssertEqInt(t, skillId, 1, "Resolve root")
+
+	_, err = api.ResolvePath("AA/XXX")
+	testutil.AssertErrGenerated(t, err, UnknownPath, "Resolve unknown")
+	_, err = api.ResolvePath("AA//AAA")
+	testutil.AssertErrGenerated(t, err, MalformedPath, "Empty title")
+	_, err = api.ResolvePath(`AA\`)
+	testutil.AssertErrGenerated(t, err, MalformedPath, "Unfinished escape")
+
+	// Titles must now be unique among siblings, but data from before then
+	// need not be.
+	legacy, _ := api.AddSkill("", Category, "AC", "Another AB", 1)
+	api.skillFromId[legacy].Title = "ab"
+	_, err = api.ResolvePath("AB")
+	testutil.AssertErrGenerated(t, err, AmbiguousPath, "Resolve ambiguous")
+}
+
+func TestParsePath(t *testing.T) {
+	titles := []string{"a/b", `c\d`, "e"}
+	titlesBack, err := ParsePath(FormatPath(titles))
+	testutil.AssertNilErr(t, err, "Round trip")
+	testutil.AssertEqSliceString(t, titlesBack, titles, "Round trip")
+	titlesBack, _ = ParsePath("")
+	testutil.AssertEqInt(t, len(titlesBack), 0, "Empty path")
+}
+
 func TestSkillQueries(t *testing.T) {
 	api := buildSimpleModel(t)
 
@@ -225,6 +961,22 @@ func TestSkillQueries(t *testing.T) {
 	testutil.AssertErrGenerated(t, err, UnknownSkill, "Skill wording getter")
 }
 
+func TestSkillSummaryQuery(t *testing.T) {
+	api := buildSimpleModel(t)
+	title, role, hasChildren, err := api.SkillSummary(3)
+	testutil.AssertNilErr(t, err, "Skill summary getter")
+	testutil.AssertEqString(t, title, "AA", "Skill summary getter")
+	testutil.AssertEqString(t, role, Category, "Skill summary getter")
+	testutil.AssertTrue(t, hasChildren, "Skill summary getter")
+
+	_, role, hasChildren, err = api.SkillSummary(4)
+	testutil.AssertEqString(t, role, Skill, "Skill summary getter")
+	testutil.AssertFalse(t, hasChildren, "Skill summary getter")
+
+	_, _, _, err = api.SkillSummary(999)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "Skill summary getter")
+}
+
 func TestPeopleWithSkillQuery(t *testing.T) {
 	api := buildSimpleModel(t)
 	emails, err := api.PeopleWithSkill(4)
@@ -241,6 +993,74 @@ func TestPeopleWithSkillQuery(t *testing.T) {
 		"People with skill getter")
 }
 
+func TestPeopleWithSkillBelowQuery(t *testing.T) {
+	api := buildSimpleModel(t)
+	skillAAB, _ := api.AddSkill("", Skill, "AAB", "AAB description", 3)
+	skillABA, _ := api.AddSkill("", Skill, "ABA", "ABA description", 2)
+	api.GivePersonSkill("fred.bloggs", skillAAB)
+	api.GivePersonSkill("john.smith", skillABA)
+
+	emails, err := api.PeopleWithSkillBelow(3)
+	testutil.AssertNilErr(t, err, "People below category")
+	testutil.AssertEqSliceString(t, emails, []string{"fred.bloggs"},
+		"Each person once")
+	emails, _ = api.PeopleWithSkillBelow(1)
+	testutil.AssertEqSliceString(t, emails,
+		[]string{"fred.bloggs", "john.smith"}, "People below root")
+	count, err := api.HolderCountBelow(4)
+	testutil.AssertNilErr(t, err, "Count for a skill")
+	testutil.AssertEqInt(t, count, 1, "Count for a skill")
+	_, err = api.HolderCountBelow(999)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "Count for nothing")
+
+	// Bulk counts honour the collapsed AA, but still count inside it.
+	skills, _, counts, err := api.EnumerateTreeWithCounts("fred.bloggs")
+	testutil.AssertNilErr(t, err, "Bulk counts")
+	testutil.AssertEqSliceInt(t, skills, []int{1, 3, 2, skillABA},
+		"Bulk counts")
+	testutil.AssertEqSliceInt(t, counts, []int{2, 1, 1, 1}, "Bulk counts")
+	_, _, _, err = api.EnumerateTreeWithCounts("nobody")
+	testutil.AssertErrGenerated(t, err, UnknownPerson, "Bulk counts")
+}
+
+func TestSearch(t *testing.T) {
+	api := buildAdminModel(t)
+	api.AddSkill("", Skill, "Go", "Programming in AAA", 2)
+	api.AddSkill("", Skill, "C++", "Systems programming", 2)
+	api.AddSkill("", Skill, "C", "Systems programming", 2)
+
+	// Title matches rank above description matches, prefixes match, and
+	// case is ignored.
+	testutil.AssertEqSliceInt(t, api.Search("aa"), []int{3, 4, 5},
+		"Title before description")
+	testutil.AssertEqSliceInt(t, api.Search("c++"), []int{6}, "Symbols")
+	testutil.AssertEqSliceInt(t, api.Search("SYSTEMS prog c"), []int{7, 6},
+		"All terms must match")
+	testutil.AssertEqSliceInt(t, api.Search("  "), []int{}, "Empty query")
+
+	// The index keeps up with changes.
+	api.SetSkillTitle(admin, 5, "Golang")
+	testutil.AssertEqSliceInt(t, api.Search("golang"), []int{5}, "Rename")
+	api.SetSkillDesc(admin, 5, "Concurrency")
+	testutil.AssertEqSliceInt(t, api.Search("programming"), []int{7, 6},
+		"Redescribe")
+	api.MergeSkills(admin, 7, 6)
+	testutil.AssertEqSliceInt(t, api.Search("c++"), []int{7}, "Merge alias")
+	api.RemoveSkill(admin, 5)
+	testutil.AssertEqSliceInt(t, api.Search("golang"), []int{}, "Remove")
+}
+
+func TestEnumerateMatchingTree(t *testing.T) {
+	api := buildSimpleModel(t)
+	skills, depths := api.EnumerateMatchingTree("aaa")
+	testutil.AssertEqSliceInt(t, skills, []int{1, 3, 4}, "Matching skills")
+	testutil.AssertEqSliceInt(t, depths, []int{0, 1, 2}, "Matching depths")
+	skills, _ = api.EnumerateMatchingTree("nothing")
+	testutil.AssertEqSliceInt(t, skills, []int{}, "Nothing matches")
+	skills, _ = api.EnumerateMatchingTree("")
+	testutil.AssertEqInt(t, len(skills), 4, "Empty query")
+}
+
 func TestHasPersonSkillQuery(t *testing.T) {
 	api := buildSimpleModel(t)
 
@@ -278,6 +1098,60 @@ func TestEnumerateTree(t *testing.T) {
 	testutil.AssertErrGenerated(t, err, UnknownPerson, "Tree enumerator")
 }
 
+func TestEnumerateWholeTree(t *testing.T) {
+	api := buildSimpleModel(t)
+	skills, depths := api.EnumerateWholeTree()
+	testutil.AssertEqSliceInt(t, skills, []int{1, 3, 4, 2}, "Whole tree")
+	testutil.AssertEqSliceInt(t, depths, []int{0, 1, 2, 1}, "Whole tree")
+}
+
+func TestSkillRelationsQuery(t *testing.T) {
+	api := buildSimpleModel(t)
+	parent, children, err := api.SkillRelations(3)
+	testutil.AssertNilErr(t, err, "Skill relations")
+	testutil.AssertEqInt(t, parent, 1, "Skill relations")
+	testutil.AssertEqSliceInt(t, children, []int{4}, "Skill relations")
+	parent, _, err = api.SkillRelations(1)
+	testutil.AssertEqInt(t, parent, -1, "Skill relations of root")
+	_, _, err = api.SkillRelations(999)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "Skill relations")
+}
+
+func TestEnumerateEmptyTree(t *testing.T) {
+	api := NewApi()
+	api.AddPerson("fred.bloggs")
+	skills, depths, err := api.EnumerateTree("fred.bloggs")
+	testutil.AssertNilErr(t, err, "Tree enumerator")
+	testutil.AssertEqInt(t, len(skills), 0, "Tree enumerator")
+	testutil.AssertEqInt(t, len(depths), 0, "Tree enumerator")
+}
+
+//-----------------------------------------------------------------------------
+// Operate virtualized UXP
+//-----------------------------------------------------------------------------
+
+func TestExpandSkill(t *testing.T) {
+	api := buildSimpleModel(t)
+	// buildSimpleModel leaves AA collapsed for fred
+	err := api.ExpandSkill("fred.bloggs", 3)
+	testutil.AssertNilErr(t, err, "Expand skill")
+	skills, _, _ := api.EnumerateTree("fred.bloggs")
+	testutil.AssertEqSliceInt(t, skills, []int{1, 3, 4, 2}, "Expand skill")
+
+	collapsed, err := api.IsCollapsed("fred.bloggs", 3)
+	testutil.AssertNilErr(t, err, "Expand skill")
+	testutil.AssertFalse(t, collapsed, "Expand skill")
+
+	// Expanding something that is not collapsed is harmless
+	err = api.ExpandSkill("fred.bloggs", 3)
+	testutil.AssertNilErr(t, err, "Expand skill")
+
+	err = api.ExpandSkill("fred.bloggs", 9999)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "Expand skill")
+	err = api.ExpandSkill("nosuchemail", 1)
+	testutil.AssertErrGenerated(t, err, UnknownPerson, "Expand skill")
+}
+
 //-----------------------------------------------------------------------------
 // Operate virtualized UXP - stimulating errors
 //-----------------------------------------------------------------------------
@@ -300,13 +1174,13 @@ func buildSimpleModel(t *testing.T) *Api {
 	api := NewApi()
 	api.AddPerson("fred.bloggs")
 	api.AddPerson("john.Smith") // deliberate inclusion of upper case letter
-	skillA, _ := api.AddSkill(Category, "A title", "A description", -1)
+	skillA, _ := api.AddSkill("fred.bloggs", Category, "A title", "A description", -1)
 	// Note AB and AA are added to a parent in common, in an order that makes
 	// their enumeration in the order that they are added, NOT in alphabetical
 	// order.
-	skillAB, _ := api.AddSkill(Category, "AB", "AB description", skillA)
-	skillAA, _ := api.AddSkill(Category, "AA", "AA description", skillA)
-	skillAAA, _ := api.AddSkill(Skill, "AAA", "AAA description", skillAA)
+	skillAB, _ := api.AddSkill("fred.bloggs", Category, "AB", "AB description", skillA)
+	skillAA, _ := api.AddSkill("fred.bloggs", Category, "AA", "AA description", skillA)
+	skillAAA, _ := api.AddSkill("fred.bloggs", Skill, "AAA", "AAA description", skillAA)
 	api.GivePersonSkill("fred.bloggs", skillAAA)
 
 	err := api.CollapseSkill("fred.bloggs", skillAA)
@@ -320,3 +1194,15 @@ func buildSimpleModel(t *testing.T) *Api {
 
 	return api
 }
+
+// The admin constant names the person that buildAdminModel() makes an admin.
+const admin = "john.smith"
+
+// The function buildAdminModel() builds the simple model, with the admin
+// person appointed.
+func buildAdminModel(t *testing.T) *Api {
+	api := buildSimpleModel(t)
+	err := api.GrantAdmin("", admin)
+	testutil.AssertNilErr(t, err, "Appoint first admin")
+	return api
+}
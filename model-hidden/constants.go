@@ -7,6 +7,14 @@ const (
 	Category = "CAT"
 )
 
+// This enumerated type provides a classification for the mutually exclusive
+// roles that a person may take. Admins may do everything that users can, and
+// also restructure the taxonomy and manage people.
+const (
+	User  = "USR"
+	Admin = "ADM"
+)
+
 // These constants specify the maximum length allowed for various fields.
 const (
 	MaxSkillTitle int = 30
@@ -16,15 +24,42 @@ const (
 // These constants provide a set of human-readable error message strings, with
 // machine-readable names.
 const (
+	AliasCycle                    = "An alias cannot stand for itself."
+	AmbiguousPath                 = "Path matches more than one skill."
 	CannotBestowCategory          = "Cannot give someone a CATEGORY skill."
+	CannotChangeRoleSkillHeld     = "Cannot make a category of a skill that people have."
+	CannotChangeRoleWithChildren  = "Cannot make a skill of a category with children."
+	CannotMergeWithItself         = "Cannot merge a skill with itself."
 	CannotRemoveRootSkill         = "Cannot remove the root skill."
 	CannotRemoveSkillHeld         = "Cannot remove a skill that people have."
 	CannotRemoveSkillWithChildren = "Cannot remove skill with children"
+	CannotSplitCategory           = "Only a skill can be split, not a category."
+	DuplicateTitle                = "Another skill here has that title."
+	EmptyTitle                    = "Title cannot be empty."
+	IllegalCycle                  = "Cannot move a skill to inside itself."
+	IllegalEmail                  = "Not a legal email address."
+	IllegalTitle                  = "Title cannot contain control characters."
 	IllegalWithRoot               = "Cannot be done with root skill."
+	LastAdmin                     = "Cannot remove the last admin."
+	MalformedPath                 = "Path is malformed."
+	NewerFormat                   = "Data was saved by a newer version of skilldrill."
+	NoDomain                      = "No email domain is configured."
+	NoChildren                    = "Need at least one skill to split into."
+	NotHeld                       = "Person does not have this skill."
+	NothingToRedo                 = "There is nothing to redo."
+	NothingToUndo                 = "There is nothing to undo."
 	ParentNotCategory             = "Parent must be a category node."
+	PermissionDenied              = "Only an admin may do this."
 	PersonExists                  = "Person exists."
+	RoleMismatch                  = "Skills must both be skills, or both categories."
 	TooLong                       = "String is too long."
+	UnknownChild                  = "No such new skill to reassign to."
+	UnknownFormat                 = "Data format version is not recognised."
 	UnknownParent                 = "Unknown parent."
+	UnknownPath                   = "No skill has that path."
 	UnknownPerson                 = "Person does not exist."
+	UnknownRole                   = "Role must be a skill or a category."
 	UnknownSkill                  = "Skill does not exist."
+	Unrepairable                  = "Data has problems that cannot be repaired."
+	WrongDomain                   = "Email address is not in our domain."
 )
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+/*
+The IdentityPolicy type defines how the model identifies people. People are
+identified by the name part of their email address, in the single
+organisation email Domain. The policy normalises the strings given to the Api
+to identify people, such that the same person always ends up with the same
+name: it lower-cases the string, strips off the domain part (when there is
+one), rejects characters that are not legal in the name part, and finally maps
+aliases (for example "fbloggs") to the name they stand for (for example
+"fred.bloggs"). When the Domain is empty, any domain is accepted (and
+stripped) - but then the policy cannot say where to email anyone.
+*/
+type IdentityPolicy struct {
+	Domain  string
+	Aliases map[string]string // alias -> name
+}
+
+// Compulsory constructor.
+func NewIdentityPolicy(domain string) *IdentityPolicy {
+	return &IdentityPolicy{
+		Domain:  strings.ToLower(domain),
+		Aliases: map[string]string{},
+	}
+}
+
+/*
+The method AddAlias() makes the given alias stand for the given name. Both are
+normalised first, and an alias for an alias is resolved to the final name. Can
+generate the errors: IllegalEmail, WrongDomain, AliasCycle.
+*/
+func (policy *IdentityPolicy) AddAlias(alias string, name string) (
+	err error) {
+	if alias, err = policy.normaliseName(alias); err != nil {
+		return
+	}
+	if name, err = policy.normalise(name); err != nil {
+		return
+	}
+	if alias == name {
+		return errors.New(AliasCycle)
+	}
+	policy.Aliases[alias] = name
+	return
+}
+
+/*
+The method Address() provides the full email address for the given name. Mail
+for a person must only ever be sent to this address, and never to an address
+as typed, since different addresses normalise to the same name. Can generate
+the error: NoDomain.
+*/
+func (policy *IdentityPolicy) Address(name string) (address string,
+	err error) {
+	if policy.Domain == "" {
+		return "", errors.New(NoDomain)
+	}
+	return name + "@" + policy.Domain, nil
+}
+
+// The method normalise() applies the policy (see the type description) to the
+// given string. Can generate the errors: IllegalEmail, WrongDomain.
+func (policy *IdentityPolicy) normalise(email string) (name string,
+	err error) {
+	if name, err = policy.normaliseName(email); err != nil {
+		return
+	}
+	if aliasFor, ok := policy.Aliases[name]; ok {
+		name = aliasFor
+	}
+	return
+}
+
+// The method normaliseName() does everything normalise() does, except for
+// resolving aliases.
+func (policy *IdentityPolicy) normaliseName(email string) (name string,
+	err error) {
+	name = strings.ToLower(strings.TrimSpace(email))
+	if at := strings.LastIndex(name, "@"); at != -1 {
+		domain := name[at+1:]
+		name = name[:at]
+		if policy.Domain != "" && domain != policy.Domain {
+			return "", errors.New(WrongDomain)
+		}
+	}
+	if legalName.MatchString(name) == false {
+		return "", errors.New(IllegalEmail)
+	}
+	return
+}
+
+// The legalName expression matches the name parts of email addresses that the
+// model accepts, e.g. "fred.bloggs", "fred_bloggs2", "f-bloggs".
+var legalName = regexp.MustCompile(`^[a-z0-9_-]+(\.[a-z0-9_-]+)*$`)
@@ -0,0 +1,177 @@
+package model
+
+import (
+	"errors"
+	"github.com/peterhoward42/skilldrill/util/sets"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+This file is how the serialized format of the model can change, without losing
+the data saved in older formats. Each serialized Api records the version of the
+format it was saved in (SerializeVers). When the format changes, the version
+is incremented, and a migration is added to the migrations list, that upgrades
+a document in the previous format to the new one. NewFromSerialized() runs the
+chain of migrations needed to bring a document up to date before building the
+Api from it. Whatever the version, the sets that a document leaves out are then
+taken to be empty (see applyDefaults()). Every format has a golden file in
+testdata, which the tests check can still be loaded.
+*/
+
+// The CurrentSerializeVers constant is the version of the format that
+// Serialize() writes.
+const CurrentSerializeVers = 2
+
+/*
+The document type is the raw form of a serialized Api, as yaml.Unmarshal()
+provides it when not given a type to unmarshal into. Migrations work on this,
+rather than on the Api type, because the Api type only knows the current
+format.
+*/
+type document map[interface{}]interface{}
+
+/*
+The migration type upgrades a document in place, from the version before the
+one it is registered for.
+*/
+type migration func(doc document) error
+
+/*
+The migrations variable is the chain of migrations. The migration at index i
+upgrades a document from version i+1 to version i+2.
+*/
+var migrations = []migration{
+	migrateFrom1,
+}
+
+/*
+The function migrate() upgrades the given serialized Api to the current format,
+and returns it re-serialized. A document without a version is taken to be
+version 1, which is what the first format was. Generates the NewerFormat error
+when the document was saved in a format more recent than this software knows
+about, and UnknownFormat when its version is not sensible.
+*/
+func migrate(in []byte) (out []byte, err error) {
+	// Unmarshalling into the document type would make the nested maps
+	// documents too, so use the type it is defined as instead.
+	raw := map[interface{}]interface{}{}
+	if err = yaml.Unmarshal(in, &raw); err != nil {
+		return
+	}
+	doc := document(raw)
+	version := 1
+	if vers, ok := doc["serializevers"]; ok {
+		if version, ok = vers.(int); !ok || version < 1 {
+			return nil, errors.New(UnknownFormat)
+		}
+	}
+	if version > CurrentSerializeVers {
+		return nil, errors.New(NewerFormat)
+	}
+	if version == CurrentSerializeVers {
+		return in, nil
+	}
+	for ; version < CurrentSerializeVers; version++ {
+		if err = migrations[version-1](doc); err != nil {
+			return
+		}
+	}
+	doc["serializevers"] = CurrentSerializeVers
+	return yaml.Marshal(doc)
+}
+
+/*
+The function migrateFrom1() upgrades a document from version 1 to version 2.
+Version 2 added the roles of people (who were all users before), the creator,
+editor and aliases of skills, and the set of split skills that each person
+needs to review. Version 1 documents written as these were added may have some
+of them already. (The missing sets are left to applyDefaults().)
+*/
+func migrateFrom1(doc document) (err error) {
+	for _, item := range listIn(doc, "people") {
+		setDefault(item, "role", User)
+	}
+	for _, item := range listIn(doc, "skills") {
+		setDefault(item, "creator", "")
+		setDefault(item, "editor", "")
+	}
+	return
+}
+
+/*
+The method applyDefaults() gives an Api that has just been de-serialized empty
+sets wherever the content left them out - the children and aliases of skills,
+the UI states of people and the sets in them, and the holdings of people and
+of skills. This is done for every version of the format (and for JSON as well
+as YAML), before the Api is verified, so that sets a document leaves out are
+not reported as problems every time it is loaded. Anything that is not a set
+is left for Verify() to deal with.
+*/
+func (api *Api) applyDefaults() {
+	if api.SkillHoldings == nil {
+		api.SkillHoldings = newSkillHoldings()
+	}
+	holdings := api.SkillHoldings
+	if holdings.SkillsOfPerson == nil {
+		holdings.SkillsOfPerson = map[string]*sets.SetOfInt{}
+	}
+	if holdings.PeopleWithSkill == nil {
+		holdings.PeopleWithSkill = map[int]*sets.SetOfString{}
+	}
+	if api.UiStates == nil {
+		api.UiStates = map[string]*uiState{}
+	}
+	for _, skill := range api.Skills {
+		if skill == nil {
+			continue
+		}
+		if skill.Children == nil {
+			skill.Children = []int{}
+		}
+		if skill.Aliases == nil {
+			skill.Aliases = []string{}
+		}
+		if holdings.PeopleWithSkill[skill.Uid] == nil {
+			holdings.PeopleWithSkill[skill.Uid] = sets.NewSetOfString()
+		}
+	}
+	for _, pers := range api.People {
+		if pers == nil || pers.Email == "" {
+			continue
+		}
+		if holdings.SkillsOfPerson[pers.Email] == nil {
+			holdings.SkillsOfPerson[pers.Email] = sets.NewSetOfInt()
+		}
+		uiState := api.UiStates[pers.Email]
+		if uiState == nil {
+			api.UiStates[pers.Email] = newUiState()
+			continue
+		}
+		if uiState.CollapsedNodes == nil {
+			uiState.CollapsedNodes = sets.NewSetOfInt()
+		}
+		if uiState.NeedsReview == nil {
+			uiState.NeedsReview = sets.NewSetOfInt()
+		}
+	}
+}
+
+// The function listIn() provides the items of the list under the given key
+// of the document, that are themselves documents.
+func listIn(doc document, key string) (items []document) {
+	list, _ := doc[key].([]interface{})
+	for _, item := range list {
+		if item, ok := item.(map[interface{}]interface{}); ok {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+// The function setDefault() sets the given key of the document to the value
+// given, unless the document has a value for it already.
+func setDefault(doc document, key string, value interface{}) {
+	if existing, ok := doc[key]; !ok || existing == nil {
+		doc[key] = value
+	}
+}
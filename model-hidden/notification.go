@@ -0,0 +1,31 @@
+package model
+
+// This enumerated type classifies the changes to a skill that its creator is
+// notified about.
+const (
+	Moved        = "moved"
+	Renamed      = "renamed"
+	Redescribed  = "redescribed"
+	Removed      = "removed"
+	Restored     = "restored after being removed"
+	Merged       = "merged into another skill"
+	Split        = "split into finer-grained skills"
+	MadeSkill    = "made into a skill"
+	MadeCategory = "made into a category"
+)
+
+/*
+The Notification type describes a change made to a skill by somebody other
+than the person who created it, and who the creator (To) is. The Title is the
+skill's title at the time of the change (i.e. before a rename or removal), and
+the Actor is the person who made the change. The model only queues
+notifications - see Api.TakeNotifications() - it is up to the caller to
+deliver them.
+*/
+type Notification struct {
+	To     string
+	Actor  string
+	Skill  int
+	Title  string
+	Change string
+}
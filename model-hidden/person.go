@@ -2,17 +2,20 @@ package model
 
 /*
 The person type models a person in terms of the user name part of their email
-address and the UID for that person.  The design intent is that none of Api
-fields are exported, but the reason that some are, is solely to facilitate
-automated serialization by yaml.Marshal().
+address, and the Role they play (one of the person role constants).  The
+design intent is that none of Api fields are exported, but the reason that
+some are, is solely to facilitate automated serialization by yaml.Marshal()
+and json.Marshal().
 */
 type person struct {
-	Email string
+	Email string `json:"email"`
+	Role  string `json:"role"`
 }
 
 // Compulsory constructor.
 func newPerson(email string) *person {
 	return &person{
 		Email: email,
+		Role:  User,
 	}
 }
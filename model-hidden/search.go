@@ -0,0 +1,150 @@
+package model
+
+import (
+	"github.com/peterhoward42/skilldrill/util/sets"
+	"strings"
+	"unicode"
+)
+
+/*
+The searchIndex type is an inverted index of the words in the skills' titles
+(including their aliases) and descriptions, which supports the full-text
+search behind Api.Search(). Words are lower case, and a search term matches
+any word that starts with it. The index is supplemental data - it is not
+serialized, and the Api must keep it up to date (using index() and unindex())
+whenever a skill is added, removed, or has its wording changed.
+*/
+type searchIndex struct {
+	titleWords map[string]*sets.SetOfInt // word -> skill.Uid
+	descWords  map[string]*sets.SetOfInt // word -> skill.Uid
+	wordsOf    map[int]*indexedWords     // skill.Uid -> what was indexed
+}
+
+// The indexedWords type records the words indexed for one skill, so that they
+// can be taken out of the index again.
+type indexedWords struct {
+	title []string
+	desc  []string
+}
+
+// A match in a skill's title is worth this many matches in its description.
+const titleWeight = 2
+
+// Compulsory constructor.
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		titleWords: map[string]*sets.SetOfInt{},
+		descWords:  map[string]*sets.SetOfInt{},
+		wordsOf:    map[int]*indexedWords{},
+	}
+}
+
+/*
+The index() method adds the given skill's wording to the index, replacing
+whatever was indexed for it before.
+*/
+func (index *searchIndex) index(skill *skillNode) {
+	index.unindex(skill.Uid)
+	titleText := strings.Join(append([]string{skill.Title},
+		skill.Aliases...), " ")
+	words := &indexedWords{title: tokenise(titleText),
+		desc: tokenise(skill.Desc)}
+	addWords(index.titleWords, words.title, skill.Uid)
+	addWords(index.descWords, words.desc, skill.Uid)
+	index.wordsOf[skill.Uid] = words
+}
+
+/*
+The unindex() method takes the given skill out of the index. It is harmless to
+call it for a skill that is not indexed.
+*/
+func (index *searchIndex) unindex(skillId int) {
+	words, ok := index.wordsOf[skillId]
+	if !ok {
+		return
+	}
+	removeWords(index.titleWords, words.title, skillId)
+	removeWords(index.descWords, words.desc, skillId)
+	delete(index.wordsOf, skillId)
+}
+
+/*
+The search() method provides the skills that match every term in the query,
+along with a score for each that ranks them. Each term scores titleWeight when
+it matches a word in the skill's title, or else 1 when it matches a word in its
+description. A query with no terms matches nothing.
+*/
+func (index *searchIndex) search(query string) (scores map[int]int) {
+	scores = map[int]int{}
+	for termIdx, term := range tokenise(query) {
+		termScores := map[int]int{}
+		index.scoreTerm(index.descWords, term, 1, termScores)
+		index.scoreTerm(index.titleWords, term, titleWeight, termScores)
+		if termIdx == 0 {
+			scores = termScores
+			continue
+		}
+		for skillId, score := range scores {
+			if termScore, ok := termScores[skillId]; ok {
+				scores[skillId] = score + termScore
+			} else {
+				delete(scores, skillId)
+			}
+		}
+	}
+	return
+}
+
+// The scoreTerm() method is a helper for search(), that sets the score of
+// every skill with a word in the given words map that starts with the term.
+func (index *searchIndex) scoreTerm(words map[string]*sets.SetOfInt,
+	term string, score int, scores map[int]int) {
+	for word, skills := range words {
+		if strings.HasPrefix(word, term) == false {
+			continue
+		}
+		for _, skillId := range skills.AsSlice() {
+			scores[skillId] = score
+		}
+	}
+}
+
+/*
+The function tokenise() breaks the given text into lower case words. Letters
+and digits make up words, as do '+' and '#' so that skills like "C++" and "C#"
+can be told apart from "C".
+*/
+func tokenise(text string) (words []string) {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '+' &&
+			r != '#'
+	})
+}
+
+// The function addWords() records in the given words map, that the skill
+// contains each of the words given.
+func addWords(wordMap map[string]*sets.SetOfInt, words []string,
+	skillId int) {
+	for _, word := range words {
+		if _, ok := wordMap[word]; !ok {
+			wordMap[word] = sets.NewSetOfInt()
+		}
+		wordMap[word].Add(skillId)
+	}
+}
+
+// The function removeWords() is the inverse of addWords(). Words that no
+// longer belong to any skill are forgotten.
+func removeWords(wordMap map[string]*sets.SetOfInt, words []string,
+	skillId int) {
+	for _, word := range words {
+		skills, ok := wordMap[word]
+		if !ok {
+			continue
+		}
+		skills.RemoveIfPresent(skillId)
+		if len(skills.AsSlice()) == 0 {
+			delete(wordMap, word)
+		}
+	}
+}
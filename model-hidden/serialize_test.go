@@ -1,12 +1,18 @@
 package model
 
 import (
+	"flag"
 	"fmt"
 	"github.com/peterhoward42/skilldrill/util/testutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
 
+var update = flag.Bool("update", false,
+	"Rewrite the golden file for the current serialization format.")
+
 /*
 The functions in this module, have two purposes. The first is to ensure that a
 an Api instance can be serialized and then de-serialized, and in so doing,
@@ -57,7 +63,8 @@ func TestDeSerialize(t *testing.T) {
 
 	// Probe correctness of data...
 
-	testutil.AssertEqInt(t, api.SerializeVers, 1, "Serialize version")
+	testutil.AssertEqInt(t, api.SerializeVers, CurrentSerializeVers,
+		"Serialize version")
 	checkSkills(t, api)
 	checkPeople(t, api)
 	checkSkillFromId(t, api)
@@ -66,6 +73,175 @@ func TestDeSerialize(t *testing.T) {
 	checkSkillHoldings(t, api)
 	testutil.AssertEqInt(t, api.NextSkill, 5, "Next skill")
 	checkUiState(t, api)
+	testutil.AssertEqSliceInt(t, api.Search("aaa"), []int{4}, "Search index")
+}
+
+func TestVerifyRepairsDeSerialized(t *testing.T) {
+	orig := buildSimpleModel(t)
+	testutil.AssertEqInt(t, len(orig.Verify(false)), 0, "Sound model")
+
+	// Break the invariants the way a careless hand edit might.
+	orig.NextSkill = 2
+	orig.skillFromId[3].Children = append(orig.skillFromId[3].Children, 99)
+	orig.skillFromId[2].Parent = 77
+	orig.SkillHoldings.PeopleWithSkill[4].Remove("fred.bloggs")
+	orig.SkillHoldings.bind(3, "john.smith")
+	orig.UiStates["ghost"] = newUiState()
+	serialized, _ := orig.Serialize()
+
+	api, err := NewFromSerialized(serialized)
+	testutil.AssertNilErr(t, err, "DeSerialize error")
+	repairs := api.Repairs()
+	testutil.AssertEqInt(t, len(repairs), 7, "Problems repaired")
+	testutil.AssertStrContains(t, strings.Join(repairs, "\n"),
+		"Skill 2 is an orphan", "Problems repaired")
+	testutil.AssertEqInt(t, len(api.Verify(false)), 0, "Repaired model")
+
+	testutil.AssertEqInt(t, api.NextSkill, 5, "Next skill repaired")
+	testutil.AssertEqSliceInt(t, api.skillFromId[3].Children, []int{4},
+		"Dangling child removed")
+	testutil.AssertEqInt(t, api.skillFromId[2].Parent, 1, "Orphan adopted")
+	holders, _ := api.PeopleWithSkill(4)
+	testutil.AssertEqSliceString(t, holders, []string{"fred.bloggs"},
+		"Holding completed")
+	testutil.AssertFalse(t, api.SkillHoldings.holds(3, "john.smith"),
+		"Category holding removed")
+	_, ok := api.UiStates["ghost"]
+	testutil.AssertFalse(t, ok, "Stray UI state removed")
+}
+
+func TestVerifyRepairsLostRoot(t *testing.T) {
+	orig := buildSimpleModel(t)
+	orig.SkillRoot = 99
+	orig.skillFromId[2].Parent = -1
+	orig.UiStates["fred.bloggs"].NeedsReview = nil
+	delete(orig.SkillHoldings.PeopleWithSkill, 2)
+	before, _ := orig.Serialize()
+
+	// Checking alone must change nothing.
+	problems := orig.Verify(false)
+	testutil.AssertEqInt(t, len(problems), 6, "Problems found")
+	after, _ := orig.Serialize()
+	testutil.AssertEqString(t, string(after), string(before),
+		"Unchanged by checking")
+
+	// With two skills lacking a parent, the first is made the root.
+	api, err := NewFromSerialized(before)
+	testutil.AssertNilErr(t, err, "DeSerialize error")
+	testutil.AssertEqInt(t, api.SkillRoot, 1, "Root chosen")
+	testutil.AssertEqInt(t, api.skillFromId[2].Parent, 1, "Orphan adopted")
+	skills, _, err := api.EnumerateTree("fred.bloggs")
+	testutil.AssertNilErr(t, err, "Enumerate repaired tree")
+	testutil.AssertEqInt(t, len(skills), 3, "Enumerate repaired tree")
+}
+
+/*
+The golden files in testdata hold the simple model, serialized in each of the
+formats there has been. When the format changes, add a migration (see
+migrate.go), and run the tests with -update to write the golden file for the
+new format. Never change the golden files of earlier formats.
+*/
+func goldenFile(version int) string {
+	return filepath.Join("testdata", fmt.Sprintf("serialized-v%d.yaml",
+		version))
+}
+
+func TestSerializeMatchesGolden(t *testing.T) {
+	serialized, err := buildSimpleModel(t).Serialize()
+	testutil.AssertNilErr(t, err, "Serialize error")
+	if *update {
+		os.WriteFile(goldenFile(CurrentSerializeVers), serialized, 0644)
+	}
+	golden, err := os.ReadFile(goldenFile(CurrentSerializeVers))
+	testutil.AssertNilErr(t, err, "Golden file for current format")
+	testutil.AssertEqString(t, string(serialized), string(golden),
+		"Serialized model")
+}
+
+func TestDeSerializeEveryFormat(t *testing.T) {
+	for version := 1; version <= CurrentSerializeVers; version++ {
+		serialized, err := os.ReadFile(goldenFile(version))
+		testutil.AssertNilErr(t, err, "Golden file")
+		api, err := NewFromSerialized(serialized)
+		testutil.AssertNilErr(t, err, "DeSerialize error")
+		testutil.AssertEqInt(t, len(api.Repairs()), 0, "Repairs needed")
+		testutil.AssertEqInt(t, api.SerializeVers, CurrentSerializeVers,
+			"Serialize version")
+		checkSkills(t, api)
+		checkPeople(t, api)
+		checkSkillHoldings(t, api)
+		checkUiState(t, api)
+		testutil.AssertFalse(t, api.IsAdmin("fred.bloggs"), "Role")
+		reviews, err := api.NeedsReview("fred.bloggs")
+		testutil.AssertNilErr(t, err, "Reviews")
+		testutil.AssertEqInt(t, len(reviews), 0, "Reviews")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	orig := buildAdminModel(t)
+	orig.SplitSkill(admin, 4, []NewChild{{"AAA1", ""}, {"AAA2", ""}}, nil)
+	viaYAML, _ := orig.Serialize()
+	viaJSON, err := orig.SerializeJSON()
+	testutil.AssertNilErr(t, err, "Serialize JSON")
+	testutil.AssertStrContains(t, string(viaJSON), `"needsreview":[4]`,
+		"JSON field names")
+
+	// JSON to YAML, and YAML to JSON, must give exactly the other form.
+	api, err := NewFromSerializedJSON(viaJSON)
+	testutil.AssertNilErr(t, err, "DeSerialize JSON")
+	testutil.AssertEqInt(t, len(api.Repairs()), 0, "Repairs needed")
+	yamlBack, _ := api.Serialize()
+	testutil.AssertEqString(t, string(yamlBack), string(viaYAML),
+		"JSON to YAML")
+	api, _ = NewFromSerialized(viaYAML)
+	jsonBack, _ := api.SerializeJSON()
+	testutil.AssertEqString(t, string(jsonBack), string(viaJSON),
+		"YAML to JSON")
+}
+
+func TestJSONMigrated(t *testing.T) {
+	_, err := NewFromSerializedJSON([]byte(`{"serializevers": 99}`))
+	testutil.AssertErrGenerated(t, err, NewerFormat, "Newer format")
+	old := `{"serializevers": 1, "skills": [{"uid": 1, "role": "CAT",
+		"title": "A title", "parent": -1}], "people": [{"email": "fred"}],
+		"skillroot": 1, "nextskill": 2}`
+	api, err := NewFromSerializedJSON([]byte(old))
+	testutil.AssertNilErr(t, err, "Old JSON")
+	testutil.AssertTrue(t, api.PersonExists("fred"), "Old JSON")
+}
+
+func TestMissingSetsNotRepairs(t *testing.T) {
+	current := fmt.Sprintf(`serializevers: %d
+skills:
+- {uid: 1, role: CAT, title: A title, parent: -1, children: [2]}
+- {uid: 2, role: SKL, title: AB, parent: 1}
+people:
+- {email: fred.bloggs, role: USR}
+- {email: john.smith, role: USR}
+skillroot: 1
+skillholdings:
+  skillsofperson: {fred.bloggs: [2]}
+  peoplewithskill: {2: [fred.bloggs]}
+nextskill: 3
+uistates:
+  fred.bloggs: {collapsednodes: [1]}
+`, CurrentSerializeVers)
+	api, err := NewFromSerialized([]byte(current))
+	testutil.AssertNilErr(t, err, "Sets left out")
+	testutil.AssertEqInt(t, len(api.Repairs()), 0, "Repairs needed")
+	testutil.AssertEqInt(t, len(api.Verify(false)), 0, "Problems")
+	reviews, err := api.NeedsReview("john.smith")
+	testutil.AssertNilErr(t, err, "Reviews")
+	testutil.AssertEqInt(t, len(reviews), 0, "Reviews")
+}
+
+func TestUnknownFormatsRefused(t *testing.T) {
+	_, err := NewFromSerialized([]byte(fmt.Sprintf("serializevers: %d\n",
+		CurrentSerializeVers+1)))
+	testutil.AssertErrGenerated(t, err, NewerFormat, "Newer format")
+	_, err = NewFromSerialized([]byte("serializevers: 0\n"))
+	testutil.AssertErrGenerated(t, err, UnknownFormat, "Silly version")
 }
 
 func checkSkills(t *testing.T, api *Api) {
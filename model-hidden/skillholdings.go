@@ -8,11 +8,11 @@ import (
 The skillHoldings type contains bindings between people and the set of skills
 they hold.  The design intent is that none of fields are exported, but the
 reason that some are, is solely to facilitate automated serialization by
-yaml.Marshal().
+yaml.Marshal() and json.Marshal().
 */
 type skillHoldings struct {
-	SkillsOfPerson  map[string]*sets.SetOfInt // email -> skill.Uid
-	PeopleWithSkill map[int]*sets.SetOfString // skill.Uid -> email
+	SkillsOfPerson  map[string]*sets.SetOfInt `json:"skillsofperson"`  // email -> skill.Uid
+	PeopleWithSkill map[int]*sets.SetOfString `json:"peoplewithskill"` // skill.Uid -> email
 }
 
 // Compulsory constructor.
@@ -82,3 +82,37 @@ func (sh *skillHoldings) bind(skill int, person string) {
 	sh.SkillsOfPerson[person].Add(skill)
 	sh.PeopleWithSkill[skill].Add(person)
 }
+
+/*
+The method unbind() is the inverse of bind(). It keeps both directions of the
+binding symmetrical, and is harmless to call when the binding does not exist.
+*/
+func (sh *skillHoldings) unbind(skill int, person string) {
+	if setOfSkills, ok := sh.SkillsOfPerson[person]; ok {
+		setOfSkills.RemoveIfPresent(skill)
+	}
+	if setOfPeople, ok := sh.PeopleWithSkill[skill]; ok {
+		setOfPeople.RemoveIfPresent(person)
+	}
+}
+
+/*
+The method transfer() moves everybody who holds the from skill, to holding the
+to skill instead.
+*/
+func (sh *skillHoldings) transfer(from int, to int) {
+	setOfPeople, ok := sh.PeopleWithSkill[from]
+	if !ok {
+		return
+	}
+	for _, email := range setOfPeople.AsSlice() {
+		sh.unbind(from, email)
+		sh.bind(to, email)
+	}
+}
+
+// The method holds() returns true if the given person holds the given skill.
+func (sh *skillHoldings) holds(skill int, person string) bool {
+	setOfSkills, ok := sh.SkillsOfPerson[person]
+	return ok && setOfSkills.Contains(skill)
+}
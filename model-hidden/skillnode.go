@@ -11,19 +11,25 @@ to be SKILLS. The others must have the role CATEGORY. The descriptive strings
 should provide only a qualification for their specialism with respect to their
 parent category, and should not duplicate this information.  The design intent
 is that none of Api fields are exported, but the reason that some are, is
-solely to facilitate automated serialization by yaml.Marshal(). The node's
-children are maintained in alphabetical order by title, and to support this
-behaviour, the caller must dependency-inject to the constructor, a mapper of
-skillId to skill title. This avoids having to duplicate in the node information
-about the world outside of itself.
+solely to facilitate automated serialization by yaml.Marshal() and
+json.Marshal(). The node's children are maintained in alphabetical order by
+title, and to support this behaviour, the caller must dependency-inject to the
+constructor, a mapper of skillId to skill title. This avoids having to
+duplicate in the node information about the world outside of itself. The
+Creator and Editor are empty when not known (for example for skills added
+before they were recorded). The Aliases are the titles of the skills that have
+been merged into this one.
 */
 type skillNode struct {
-	Uid      int
-	Role     string // SKILL | CATEGORY
-	Title    string
-	Desc     string
-	Parent   int
-	Children []int // Do not alter this directly, use addChild()
+	Uid      int      `json:"uid"`
+	Role     string   `json:"role"` // SKILL | CATEGORY
+	Title    string   `json:"title"`
+	Desc     string   `json:"desc"`
+	Parent   int      `json:"parent"`
+	Children []int    `json:"children"` // Do not alter this directly, use addChild()
+	Creator  string   `json:"creator"`  // email of the person who added the skill
+	Editor   string   `json:"editor"`   // email of the person who last changed it
+	Aliases  []string `json:"aliases"`  // titles of skills merged into this one
 	mapper   titleMapper
 }
 
@@ -37,33 +43,54 @@ func newSkillNode(uid int, role string, title string, desc string,
 		Desc:     desc,
 		Parent:   parent,
 		Children: []int{},
+		Aliases:  []string{},
 		mapper:   mapper,
 	}
 }
 
 /*
 The method addChild() adds the given skill uid into the list held of this
-node's children - whilst maintaining their alphabetical order. Not completely
-straightforward, because the skill node knows only about the Uid's of the other
-children, and not (in of itself) their titles.
+node's children - whilst maintaining their alphabetical order.
 */
 func (skill *skillNode) addChild(newChild int) {
 	skill.Children = append(skill.Children, newChild)
+	skill.sortChildren()
+}
 
-	// Reestablish the order by obtaining the titles of the peer children and
-	// noting the consequences of sorting the list of titles.
-
-	uids := map[string]int{} // uids keyed on titles
-	titles := []string{}
+/*
+The method sortChildren() re-establishes the alphabetical order of this node's
+children, which is needed when one of them is renamed. Not completely
+straightforward, because the skill node knows only about the Uid's of the other
+children, and not (in of itself) their titles. Children with the same title
+(which only data from before titles had to be unique can have) keep the order
+of their Uids.
+*/
+func (skill *skillNode) sortChildren() {
+	titles := map[int]string{} // titles keyed on uids
 	for _, uid := range skill.Children {
-		title := skill.mapper.titleFromId(uid)
-		uids[title] = uid
-		titles = append(titles, title)
+		titles[uid] = skill.mapper.titleFromId(uid)
+	}
+	sort.SliceStable(skill.Children, func(i, j int) bool {
+		left, right := skill.Children[i], skill.Children[j]
+		if titles[left] != titles[right] {
+			return titles[left] < titles[right]
+		}
+		return left < right
+	})
+}
+
+// The method addAlias() records the given title as an alternative title for
+// the skill, unless it is the title, or an alias already.
+func (skill *skillNode) addAlias(alias string) {
+	if alias == skill.Title {
+		return
 	}
-	sort.Strings(titles)
-	for idx, title := range titles {
-		skill.Children[idx] = uids[title]
+	for _, existing := range skill.Aliases {
+		if existing == alias {
+			return
+		}
 	}
+	skill.Aliases = append(skill.Aliases, alias)
 }
 
 /*
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"errors"
+	"strings"
+)
+
+/*
+A skill path is the human-readable way to refer to a skill. It is the titles
+of the skills on the way down the tree to it, starting below the root, joined
+by PathSeparator - for example "Software/Languages/Go". The root's path is
+empty. Titles that contain the separator, or the PathEscape character, have
+them escaped by a preceding PathEscape, so that "Software/CI\/CD" is the skill
+"CI/CD" in the category "Software".
+*/
+const (
+	PathSeparator = '/'
+	PathEscape    = '\\'
+)
+
+/*
+The function FormatPath() joins the given titles into a skill path, escaping
+them as need be.
+*/
+func FormatPath(titles []string) string {
+	escaped := []string{}
+	for _, title := range titles {
+		title = strings.Replace(title, string(PathEscape),
+			string(PathEscape)+string(PathEscape), -1)
+		title = strings.Replace(title, string(PathSeparator),
+			string(PathEscape)+string(PathSeparator), -1)
+		escaped = append(escaped, title)
+	}
+	return strings.Join(escaped, string(PathSeparator))
+}
+
+/*
+The function ParsePath() is the inverse of FormatPath(). It splits the given
+skill path into the titles it is made of, and removes the escaping. The empty
+path has no titles. Generates the MalformedPath error when the path has an
+empty title in it, or ends with an unfinished escape.
+*/
+func ParsePath(path string) (titles []string, err error) {
+	titles = []string{}
+	if path == "" {
+		return
+	}
+	title := []rune{}
+	escaping := false
+	for _, r := range path {
+		switch {
+		case escaping:
+			title = append(title, r)
+			escaping = false
+		case r == PathEscape:
+			escaping = true
+		case r == PathSeparator:
+			titles = append(titles, string(title))
+			title = []rune{}
+		default:
+			title = append(title, r)
+		}
+	}
+	titles = append(titles, string(title))
+	if escaping {
+		return []string{}, errors.New(MalformedPath)
+	}
+	for _, title := range titles {
+		if title == "" {
+			return []string{}, errors.New(MalformedPath)
+		}
+	}
+	return
+}
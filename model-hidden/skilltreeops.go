@@ -55,6 +55,43 @@ func (treeOps *skillTreeOps) lineageOf(skill *skillNode,
 	*lineage = append(*lineage, skill)
 }
 
+/*
+The subTree() method provides the Uids of the given skill and all of its
+descendants, in the order they appear in the tree.
+*/
+func (treeOps *skillTreeOps) subTree(skill *skillNode) (skills []int) {
+	skills = []int{skill.Uid}
+	for _, child := range skill.Children {
+		skills = append(skills,
+			treeOps.subTree(treeOps.api.skillFromId[child])...)
+	}
+	return
+}
+
+/*
+The holdersBelow() method provides the set of people who hold the given skill
+or any skill beneath it in the tree. It works bottom up, in one pass, and
+records the set it finds for each node in the sub-tree in the holders map - so
+that a caller wanting the sets for a whole tree need only call it for the root.
+*/
+func (treeOps *skillTreeOps) holdersBelow(skill *skillNode,
+	holders map[int]*sets.SetOfString) (found *sets.SetOfString) {
+	found = sets.NewSetOfString()
+	if skill.Role == Skill {
+		skillHoldings := treeOps.api.SkillHoldings
+		found.Overwrite(skillHoldings.PeopleWithSkill[skill.Uid].AsSlice())
+	}
+	for _, child := range skill.Children {
+		childHolders := treeOps.holdersBelow(treeOps.api.skillFromId[child],
+			holders)
+		for _, email := range childHolders.AsSlice() {
+			found.Add(email)
+		}
+	}
+	holders[skill.Uid] = found
+	return
+}
+
 /*
 The method enumerateTree() provides a list of skill Uids in the order they
 should appear when displaying the tree. It is person-specific, and omits the
@@ -63,9 +100,12 @@ children.
 */
 func (treeOps *skillTreeOps) enumerateTree(collapsedNodes *sets.SetOfInt) (
 	skills []int, depths []int) {
-	curNode := treeOps.api.skillFromId[treeOps.api.SkillRoot]
 	skills = []int{}
 	depths = []int{}
+	if treeOps.api.SkillRoot == -1 {
+		return
+	}
+	curNode := treeOps.api.skillFromId[treeOps.api.SkillRoot]
 	curDepth := 0
 	// Recursive
 	treeOps.enumerateNode(curNode, collapsedNodes, curDepth, &skills, &depths)
@@ -91,3 +131,34 @@ func (treeOps *skillTreeOps) enumerateNode(curNode *skillNode,
 	}
 	return
 }
+
+/*
+The method enumerateSubset() is like enumerateTree(), but is not
+person-specific, and includes only the given nodes. The caller must include the
+ancestors of every node it includes.
+*/
+func (treeOps *skillTreeOps) enumerateSubset(included *sets.SetOfInt) (
+	skills []int, depths []int) {
+	skills = []int{}
+	depths = []int{}
+	if treeOps.api.SkillRoot == -1 || !included.Contains(
+		treeOps.api.SkillRoot) {
+		return
+	}
+	rootNode := treeOps.api.skillFromId[treeOps.api.SkillRoot]
+	treeOps.enumerateIncluded(rootNode, included, 0, &skills, &depths)
+	return
+}
+
+// Recursive helper for the enumerateSubset() method.
+func (treeOps *skillTreeOps) enumerateIncluded(curNode *skillNode,
+	included *sets.SetOfInt, curDepth int, skills *[]int, depths *[]int) {
+	*skills = append(*skills, curNode.Uid)
+	*depths = append(*depths, curDepth)
+	for _, child := range curNode.Children {
+		if included.Contains(child) {
+			treeOps.enumerateIncluded(treeOps.api.skillFromId[child],
+				included, curDepth+1, skills, depths)
+		}
+	}
+}
@@ -7,17 +7,22 @@ import (
 /*
 The uiState() type is the model that represents a state that the abstracted
 user experience can be in. For example, which of the nodes in the skills tree
-are collapsed.  The design intent is that none of Api fields are exported, but
-the reason that some are, is solely to facilitate automated serialization by
-yaml.Marshal().
+are collapsed, and which (split) skills the person needs to review, by picking
+the specific new skills that apply to them.  The design intent is that none
+of Api fields are exported, but the reason that some are, is solely to
+facilitate automated serialization by yaml.Marshal() and json.Marshal().
 */
 type uiState struct {
-	CollapsedNodes *sets.SetOfInt
+	CollapsedNodes *sets.SetOfInt `json:"collapsednodes"`
+	NeedsReview    *sets.SetOfInt `json:"needsreview"`
 }
 
 // Compulsory constructor.
 func newUiState() *uiState {
-	return &uiState{CollapsedNodes: sets.NewSetOfInt()}
+	return &uiState{
+		CollapsedNodes: sets.NewSetOfInt(),
+		NeedsReview:    sets.NewSetOfInt(),
+	}
 }
 
 /*
@@ -31,6 +36,25 @@ func (s *uiState) collapseNode(node *skillNode) {
 	s.CollapsedNodes.Add(node.Uid)
 }
 
+// The function expandNode() is the inverse of collapseNode().
+func (s *uiState) expandNode(node *skillNode) {
+	s.CollapsedNodes.RemoveIfPresent(node.Uid)
+}
+
 func (s *uiState) NotifySkillIsRemoved(skillId int) {
 	s.CollapsedNodes.RemoveIfPresent(skillId)
+	s.NeedsReview.RemoveIfPresent(skillId)
+}
+
+// The function notifySkillIsMerged() transfers the collapsed state of the
+// absorbed node to the node it has been merged into.
+func (s *uiState) notifySkillIsMerged(absorbed int, kept int) {
+	if s.CollapsedNodes.Contains(absorbed) {
+		s.CollapsedNodes.Remove(absorbed)
+		s.CollapsedNodes.Add(kept)
+	}
+	if s.NeedsReview.Contains(absorbed) {
+		s.NeedsReview.Remove(absorbed)
+		s.NeedsReview.Add(kept)
+	}
 }
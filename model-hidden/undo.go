@@ -0,0 +1,441 @@
+package model
+
+import (
+	"errors"
+)
+
+/*
+This file is the undo history of the taxonomy edits that people make: adding,
+renaming, re-describing (or both), moving and removing skills. Each of the Api
+methods that makes one of these edits records what it did (an edit) on the
+actor's undo stack, with enough information to reverse it. Api.Undo() reverses
+the actor's most recent edit, and moves it to their redo stack, from which
+Api.Redo() can make it again. Each person has their own stacks, which hold at
+most MaxUndoDepth edits, and a new edit empties their redo stack.
+
+Somebody else's edit to a skill can make the reversal of an earlier edit to it
+unsafe (for example, undoing a move after another admin has moved the skill
+somewhere else), so whenever a skill is edited, the edits of other people that
+involved it - or that relied on it as a parent - are dropped from their stacks.
+So are everybody's edits that involved a skill that is merged, split, or has
+its role changed, since those changes cannot be undone. An edit whose reversal
+fails because the tree no longer has the skills it needs is dropped too, rather
+than blocking the edits beneath it. The history is supplemental data - it is
+not serialized, and ForgetUndoHistory() lets the owner of the Api decide when
+it begins.
+*/
+
+// MaxUndoDepth is the number of edits that each person can undo.
+const MaxUndoDepth = 20
+
+// This enumerated type classifies the edits that can be undone.
+const (
+	editAdd     = "addition"
+	editRemove  = "removal"
+	editTitle   = "rename"
+	editDesc    = "description change"
+	editWording = "rewording"
+	editMove    = "move"
+)
+
+/*
+The edit type records one undoable edit. The skill is the one edited, and the
+touched skills are those that another person's edit would conflict with. The
+parents are the skills that undoing or redoing the edit relies upon, which
+are also in conflict when another person edits them. The text is the title or
+description before and after the edit (or for a rewording, the title, with
+the description in desc), and the parent is the skill's parent before and
+after. The removed field is the skill as it was when it was last
+removed, so that it can be restored.
+*/
+type edit struct {
+	kind    string
+	skill   int
+	title   string // at the time of the edit, for describing it
+	touched []int
+	parents []int
+	text    [2]string
+	desc    [2]string
+	parent  [2]int
+	removed *removedSkill
+}
+
+/*
+The removedSkill type holds everything about a removed skill that is needed to
+put it back as it was: the node (without children, since a skill with children
+cannot be removed), its position in the Api's list of skills, and the people
+who had it collapsed or needed to review it.
+*/
+type removedSkill struct {
+	node      skillNode
+	index     int
+	collapsed []string
+	reviewing []string
+}
+
+/*
+The undoHistory type holds everybody's undo and redo stacks, with the most
+recent edit last. The dropped descriptions say which edit each person most
+recently tried to undo or redo, but could not, so it was dropped. The busy
+flag is set while an edit is being undone or redone, so that the Api methods
+used to do so do not record it as a new edit.
+*/
+type undoHistory struct {
+	undo    map[string][]*edit // email -> edits
+	redo    map[string][]*edit // email -> edits
+	dropped map[string]string  // email -> description
+	busy    bool
+}
+
+// Compulsory constructor.
+func newUndoHistory() *undoHistory {
+	return &undoHistory{
+		undo:    map[string][]*edit{},
+		redo:    map[string][]*edit{},
+		dropped: map[string]string{},
+	}
+}
+
+/*
+The unreversible errors are those that mean an edit can no longer be undone or
+redone at all, since the tree no longer has the skills it needs, or has them
+in a different arrangement. Other errors (such as PermissionDenied, or
+CannotRemoveSkillHeld) may well not apply later, so the edit is kept.
+*/
+var unreversible = map[string]bool{
+	IllegalCycle:      true,
+	IllegalWithRoot:   true,
+	ParentNotCategory: true,
+	UnknownParent:     true,
+	UnknownSkill:      true,
+}
+
+/*
+The Undo() method reverses the most recent edit that the given person made,
+that they have not already undone. The reversal is made on the person's behalf,
+and so is subject to the same checks as the Api method that made the edit (and
+the skill's creator is notified in the same way). Only an admin may undo a
+move or removal. Can generate the NothingToUndo error, and the errors of the
+Api methods involved, in which case the edit remains to be undone - except
+when the error means that the edit can never be undone, in which case the edit
+is dropped instead, no error is generated, and UndoState() says so. (Since
+dropping the edit changes the history, it must be a success, so that the owner
+of the Api keeps it along with the other changes.)
+*/
+func (api *Api) Undo(actor string) (err error) {
+	return api.reverse(actor, api.history.undo, api.history.redo,
+		NothingToUndo, api.undoEdit)
+}
+
+/*
+The Redo() method makes again the edit that the given person most recently
+undid. The same rules apply as for Undo(). Can generate the NothingToRedo
+error.
+*/
+func (api *Api) Redo(actor string) (err error) {
+	return api.reverse(actor, api.history.redo, api.history.undo,
+		NothingToRedo, api.redoEdit)
+}
+
+/*
+The method UndoState() describes the edits that Undo() and Redo() would
+reverse or make for the given person, such as "rename of Go", and the edit
+that their last attempt to undo or redo had to drop instead (see Undo()),
+with the reason. The descriptions are empty when there is nothing to undo,
+redo or report. Can generate the UnknownPerson error.
+*/
+func (api *Api) UndoState(email string) (undo string, redo string,
+	dropped string, err error) {
+	if err = api.tweakParams(&email, nil); err != nil {
+		return
+	}
+	if stack := api.history.undo[email]; len(stack) != 0 {
+		undo = stack[len(stack)-1].describe()
+	}
+	if stack := api.history.redo[email]; len(stack) != 0 {
+		redo = stack[len(stack)-1].describe()
+	}
+	dropped = api.history.dropped[email]
+	return
+}
+
+/*
+The method ForgetUndoHistory() empties everybody's undo and redo stacks. The
+owner of the Api calls this whenever the edits made so far should no longer be
+undoable - such as when it saves the Api, so that the history held only ever
+covers changes made since the Api was last de-serialized.
+*/
+func (api *Api) ForgetUndoHistory() {
+	api.history = newUndoHistory()
+}
+
+//----------------------------------------------------------------------------
+// Module Private Methods
+//----------------------------------------------------------------------------
+
+/*
+The method reverse() is the implementation of Undo() and Redo(), which take
+the most recent edit from the actor's stack in the given from stacks, apply it
+using the given function, and put it on the actor's stack in the given to
+stacks. When there is no edit, the given error is generated.
+*/
+func (api *Api) reverse(actor string, from map[string][]*edit,
+	to map[string][]*edit, emptyErr string,
+	apply func(actor string, edit *edit) error) (err error) {
+	if err = api.tweakParams(&actor, nil); err != nil {
+		return
+	}
+	stack := from[actor]
+	if len(stack) == 0 {
+		return errors.New(emptyErr)
+	}
+	edit := stack[len(stack)-1]
+	api.history.busy = true
+	err = apply(actor, edit)
+	api.history.busy = false
+	if err != nil && unreversible[err.Error()] == false {
+		return
+	}
+	from[actor] = stack[:len(stack)-1]
+	delete(api.history.dropped, actor)
+	if err != nil {
+		api.history.dropped[actor] = edit.describe() + " (" + err.Error() + ")"
+		return nil
+	}
+	api.history.push(to, actor, edit)
+	api.history.invalidate(actor, edit.touched)
+	return
+}
+
+// The method undoEdit() reverses the given edit on behalf of the actor.
+func (api *Api) undoEdit(actor string, edit *edit) (err error) {
+	switch edit.kind {
+	case editAdd:
+		err = api.takeEditedSkill(actor, edit)
+	case editRemove:
+		if err = api.requireAdmin(&actor); err != nil {
+			return
+		}
+		err = api.restoreSkill(actor, edit.removed)
+	case editTitle:
+		err = api.SetSkillTitle(actor, edit.skill, edit.text[0])
+	case editDesc:
+		err = api.SetSkillDesc(actor, edit.skill, edit.text[0])
+	case editWording:
+		err = api.SetSkillWording(actor, edit.skill, edit.text[0],
+			edit.desc[0])
+	case editMove:
+		err = api.ReParentSkill(actor, edit.skill, edit.parent[0])
+	}
+	return
+}
+
+// The method redoEdit() makes the given edit again on behalf of the actor.
+func (api *Api) redoEdit(actor string, edit *edit) (err error) {
+	switch edit.kind {
+	case editAdd:
+		err = api.restoreSkill(actor, edit.removed)
+	case editRemove:
+		if err = api.requireAdmin(&actor); err != nil {
+			return
+		}
+		err = api.takeEditedSkill(actor, edit)
+	case editTitle:
+		err = api.SetSkillTitle(actor, edit.skill, edit.text[1])
+	case editDesc:
+		err = api.SetSkillDesc(actor, edit.skill, edit.text[1])
+	case editWording:
+		err = api.SetSkillWording(actor, edit.skill, edit.text[1],
+			edit.desc[1])
+	case editMove:
+		err = api.ReParentSkill(actor, edit.skill, edit.parent[1])
+	}
+	return
+}
+
+// The method takeEditedSkill() removes the skill of the given edit, using
+// takeSkill(), and records what is needed to restore it in the edit.
+func (api *Api) takeEditedSkill(actor string, edit *edit) (err error) {
+	removed, err := api.takeSkill(actor, edit.skill)
+	if err != nil {
+		return
+	}
+	edit.removed = removed
+	return
+}
+
+/*
+The method takeSkill() removes the given skill on behalf of the actor (who is
+not checked), and provides what is needed to restore it. The skill's creator
+is notified. Can generate the following errors: UnknownSkill,
+CannotRemoveRootSkill, CannotRemoveSkillWithChildren, CannotRemoveSkillHeld.
+*/
+func (api *Api) takeSkill(actor string, skillId int) (
+	removed *removedSkill, err error) {
+	// The order of the following tests makes it easier to design tests.
+	if err = api.tweakParams(nil, &skillId); err != nil {
+		return
+	}
+	if skillId == api.SkillRoot {
+		return nil, errors.New(CannotRemoveRootSkill)
+	}
+	departingSkill := api.skillFromId[skillId]
+	if len(departingSkill.Children) != 0 {
+		return nil, errors.New(CannotRemoveSkillWithChildren)
+	}
+	if len(api.SkillHoldings.PeopleWithSkill[skillId].AsSlice()) != 0 {
+		return nil, errors.New(CannotRemoveSkillHeld)
+	}
+	removed = &removedSkill{node: *departingSkill}
+	removed.node.Aliases = append([]string{}, departingSkill.Aliases...)
+	for idx, skill := range api.Skills {
+		if skill == departingSkill {
+			removed.index = idx
+		}
+	}
+	for _, email := range sortedUiStateKeys(api.UiStates) {
+		if api.UiStates[email].CollapsedNodes.Contains(skillId) {
+			removed.collapsed = append(removed.collapsed, email)
+		}
+		if api.UiStates[email].NeedsReview.Contains(skillId) {
+			removed.reviewing = append(removed.reviewing, email)
+		}
+	}
+	api.notifyCreator(actor, departingSkill, Removed)
+	api.removeSkillNode(departingSkill)
+	return
+}
+
+/*
+The method restoreSkill() is the inverse of takeSkill(). The skill goes back
+under its old parent, which must still be a category, and must not have
+another child with the same title by now. The people who had it collapsed, or
+needed to review it, and are still registered, do so again. The skill's
+creator is notified. Can generate the following errors: UnknownParent,
+ParentNotCategory, DuplicateTitle.
+*/
+func (api *Api) restoreSkill(actor string, removed *removedSkill) (err error) {
+	parentSkill, ok := api.skillFromId[removed.node.Parent]
+	if !ok {
+		return errors.New(UnknownParent)
+	}
+	if parentSkill.Role != Category {
+		return errors.New(ParentNotCategory)
+	}
+	if err = api.checkUniqueTitle(parentSkill.Uid, -1,
+		removed.node.Title); err != nil {
+		return
+	}
+	skill := &skillNode{}
+	*skill = removed.node
+	skill.Children = []int{}
+	skill.Aliases = append([]string{}, removed.node.Aliases...)
+	skill.mapper = api
+	index := removed.index
+	if index > len(api.Skills) {
+		index = len(api.Skills)
+	}
+	api.Skills = append(api.Skills[:index], append([]*skillNode{skill},
+		api.Skills[index:]...)...)
+	api.skillFromId[skill.Uid] = skill
+	api.SkillHoldings.registerSkill(skill.Uid)
+	api.search.index(skill)
+	parentSkill.addChild(skill.Uid)
+	for _, email := range removed.collapsed {
+		if uiState, ok := api.UiStates[email]; ok {
+			uiState.CollapsedNodes.Add(skill.Uid)
+		}
+	}
+	for _, email := range removed.reviewing {
+		if uiState, ok := api.UiStates[email]; ok {
+			uiState.NeedsReview.Add(skill.Uid)
+		}
+	}
+	api.notifyCreator(actor, skill, Restored)
+	return
+}
+
+/*
+The method record() adds the given edit, made by the given actor, to their undo
+stack, and empties their redo stack. The edits of other people that the new
+edit conflicts with are dropped. Nothing is recorded for an unknown actor, or
+while an edit is being undone or redone.
+*/
+func (history *undoHistory) record(actor string, edit *edit) {
+	if actor == "" || history.busy {
+		return
+	}
+	delete(history.redo, actor)
+	delete(history.dropped, actor)
+	history.push(history.undo, actor, edit)
+	history.invalidate(actor, edit.touched)
+}
+
+/*
+The method conflict() drops every edit (including those of the actor) that
+involved any of the given skills, because they have been changed in a way that
+cannot be undone.
+*/
+func (history *undoHistory) conflict(touched []int) {
+	history.invalidate("", touched)
+}
+
+// The method forget() drops the stacks of the given person.
+func (history *undoHistory) forget(email string) {
+	delete(history.undo, email)
+	delete(history.redo, email)
+	delete(history.dropped, email)
+}
+
+// The method push() adds the edit to the top of the actor's stack in the given
+// stacks, dropping the oldest edit when the stack is full.
+func (history *undoHistory) push(stacks map[string][]*edit, actor string,
+	edit *edit) {
+	stack := append(stacks[actor], edit)
+	if len(stack) > MaxUndoDepth {
+		stack = stack[len(stack)-MaxUndoDepth:]
+	}
+	stacks[actor] = stack
+}
+
+/*
+The method invalidate() drops the edits that involved (or relied upon) any of
+the given skills from the stacks of everybody except the owner. (The owner's
+own edits remain valid, because they can only be undone in reverse order.)
+*/
+func (history *undoHistory) invalidate(owner string, touched []int) {
+	for _, stacks := range []map[string][]*edit{history.undo, history.redo} {
+		for email, stack := range stacks {
+			if email == owner {
+				continue
+			}
+			kept := []*edit{}
+			for _, edit := range stack {
+				if edit.involves(touched) == false {
+					kept = append(kept, edit)
+				}
+			}
+			stacks[email] = kept
+		}
+	}
+}
+
+// The method involves() reports whether the edit involved, or relied upon as
+// a parent, any of the given skills.
+func (edit *edit) involves(skills []int) bool {
+	for _, involved := range [][]int{edit.touched, edit.parents} {
+		for _, touched := range involved {
+			for _, skillId := range skills {
+				if touched == skillId {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// The method describe() provides a description of the edit, for people.
+func (edit *edit) describe() string {
+	return edit.kind + " of " + edit.title
+}
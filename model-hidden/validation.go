@@ -0,0 +1,65 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+/*
+This file holds the rules that the wording of skills must follow. Every Api
+method that sets a skill's title or description, or that gives a skill new
+siblings, applies them - so that however a skill came to be where it is, its
+title is not empty, and has no control characters (such as line breaks, since
+titles appear in email subject lines), neither its title nor its description
+is too long, and no other skill with the same parent has the same title
+(ignoring case, since skill paths are resolved ignoring case - see
+ResolvePath()).
+*/
+
+/*
+The function tidyTitle() trims the white space from each end of the given
+title, and then checks it. Can generate the EmptyTitle, IllegalTitle and
+TooLong errors.
+*/
+func tidyTitle(title *string) (err error) {
+	*title = strings.TrimSpace(*title)
+	if *title == "" {
+		return errors.New(EmptyTitle)
+	}
+	if strings.IndexFunc(*title, unicode.IsControl) != -1 {
+		return errors.New(IllegalTitle)
+	}
+	if len(*title) > MaxSkillTitle {
+		return errors.New(TooLong)
+	}
+	return
+}
+
+/*
+The function tidyDesc() trims the white space from each end of the given
+description, and then checks it. Can generate the TooLong error.
+*/
+func tidyDesc(desc *string) (err error) {
+	*desc = strings.TrimSpace(*desc)
+	if len(*desc) > MaxSkillDesc {
+		return errors.New(TooLong)
+	}
+	return
+}
+
+/*
+The method checkUniqueTitle() generates the DuplicateTitle error when a child
+of the given parent already has the given title. The self skill (when not -1)
+is left out of the comparison, so that a skill does not clash with itself.
+*/
+func (api *Api) checkUniqueTitle(parent int, self int, title string) (
+	err error) {
+	for _, sibling := range api.skillFromId[parent].Children {
+		if sibling != self &&
+			strings.EqualFold(api.skillFromId[sibling].Title, title) {
+			return errors.New(DuplicateTitle)
+		}
+	}
+	return
+}
@@ -0,0 +1,514 @@
+package model
+
+import (
+	"fmt"
+	"github.com/peterhoward42/skilldrill/util/sets"
+	"sort"
+)
+
+/*
+The integrityChecker type is a place for the checks made by Api.Verify() to
+live. Each check looks for violations of one of the invariants that the Api
+relies on, between the data it holds more than once (for example a skill's
+Parent field, and its parent's Children list). A check describes each
+violation it finds, and when repair is set, also puts it right - in the way
+that loses the least information.
+*/
+type integrityChecker struct {
+	api      *Api
+	repair   bool
+	problems []string
+	skills   []*skillNode // the skills listed, less any dropped
+	people   []*person    // the people listed, less any dropped
+
+	// The holdings being checked (see checkHoldings()).
+	skillsOf   map[string]*sets.SetOfInt
+	peopleWith map[int]*sets.SetOfString
+}
+
+// The method report() records a problem found.
+func (checker *integrityChecker) report(format string, args ...interface{}) {
+	checker.problems = append(checker.problems, fmt.Sprintf(format, args...))
+}
+
+/*
+The method checkSkills() checks that every skill has a Uid of its own, and a
+known role. A skill whose Uid has already been seen is dropped, and an unknown
+role is replaced by Category or Skill, according to whether the skill has
+children.
+*/
+func (checker *integrityChecker) checkSkills() {
+	api := checker.api
+	seen := map[int]bool{}
+	kept := []*skillNode{}
+	for _, skill := range api.Skills {
+		if skill == nil {
+			checker.report("An empty skill is listed")
+			continue
+		}
+		if seen[skill.Uid] {
+			checker.report("Skill %d is listed more than once", skill.Uid)
+			continue
+		}
+		seen[skill.Uid] = true
+		kept = append(kept, skill)
+		if skill.Role != Skill && skill.Role != Category {
+			checker.report("Skill %d has unknown role %q", skill.Uid,
+				skill.Role)
+			if checker.repair {
+				skill.Role = Skill
+				if len(skill.Children) != 0 {
+					skill.Role = Category
+				}
+			}
+		}
+	}
+	checker.skills = kept
+	if checker.repair {
+		api.Skills = kept
+		api.skillFromId = map[int]*skillNode{}
+		for _, skill := range kept {
+			api.skillFromId[skill.Uid] = skill
+		}
+	}
+}
+
+/*
+The method checkRoot() checks that the root is a known skill without a parent,
+or is -1 when there are no skills. When the root is unknown, the first skill
+without a parent is made the root (and the others become orphans, which
+checkParents() deals with) - or the first skill of all, when every skill has a
+parent, which can only be so when they form a cycle.
+*/
+func (checker *integrityChecker) checkRoot() {
+	api := checker.api
+	if len(checker.skills) == 0 {
+		if api.SkillRoot != -1 {
+			checker.report("Root skill %d is given, but there are no skills",
+				api.SkillRoot)
+			if checker.repair {
+				api.SkillRoot = -1
+			}
+		}
+		return
+	}
+	if root, ok := api.skillFromId[api.SkillRoot]; ok {
+		if root.Parent != -1 {
+			checker.report("Root skill %d has parent %d", root.Uid,
+				root.Parent)
+			if checker.repair {
+				root.Parent = -1
+			}
+		}
+		return
+	}
+	checker.report("Root skill %d does not exist", api.SkillRoot)
+	candidates := []int{}
+	for _, skill := range checker.skills {
+		if _, ok := api.skillFromId[skill.Parent]; !ok {
+			candidates = append(candidates, skill.Uid)
+		}
+	}
+	if checker.repair == false {
+		return
+	}
+	api.SkillRoot = checker.skills[0].Uid
+	if len(candidates) != 0 {
+		api.SkillRoot = candidates[0]
+	}
+	api.skillFromId[api.SkillRoot].Parent = -1
+}
+
+/*
+The method checkChildren() checks that every child listed by a skill exists,
+is listed once, and names that skill as its parent - the parent named by the
+child is taken to be the truth. A Skill with children is made a Category.
+*/
+func (checker *integrityChecker) checkChildren() {
+	api := checker.api
+	for _, skill := range checker.skills {
+		seen := map[int]bool{}
+		kept := []int{}
+		for _, child := range skill.Children {
+			childSkill, ok := api.skillFromId[child]
+			switch {
+			case !ok:
+				checker.report("Skill %d lists child %d, which does not "+
+					"exist", skill.Uid, child)
+			case seen[child]:
+				checker.report("Skill %d lists child %d more than once",
+					skill.Uid, child)
+			case childSkill.Parent != skill.Uid:
+				checker.report("Skill %d lists child %d, whose parent is %d",
+					skill.Uid, child, childSkill.Parent)
+			default:
+				kept = append(kept, child)
+			}
+			seen[child] = true
+		}
+		if checker.repair {
+			skill.Children = kept
+		}
+		if skill.Role == Skill && len(kept) != 0 {
+			checker.report("Skill %d has children, but is not a category",
+				skill.Uid)
+			if checker.repair {
+				skill.Role = Category
+			}
+		}
+	}
+}
+
+/*
+The method checkParents() checks that every skill but the root has a parent
+that is a Category, and that lists it as a child. An orphan, whose parent does
+not exist, is moved to the root, and a skill missing from its parent's list of
+children is added to it.
+*/
+func (checker *integrityChecker) checkParents() {
+	api := checker.api
+	root, rootOk := api.skillFromId[api.SkillRoot]
+	for _, skill := range checker.skills {
+		if skill.Uid == api.SkillRoot {
+			continue
+		}
+		parent, ok := api.skillFromId[skill.Parent]
+		if !ok {
+			checker.report("Skill %d is an orphan; parent %d does not exist",
+				skill.Uid, skill.Parent)
+			if checker.repair && rootOk {
+				checker.adopt(root, skill)
+			}
+			continue
+		}
+		if parent.Role != Category {
+			checker.report("Skill %d has parent %d, which is not a category",
+				skill.Uid, parent.Uid)
+			if checker.repair {
+				parent.Role = Category
+			}
+		}
+		listed := false
+		for _, child := range parent.Children {
+			listed = listed || child == skill.Uid
+		}
+		if !listed {
+			checker.report("Skill %d is not listed as a child of its "+
+				"parent %d", skill.Uid, parent.Uid)
+			if checker.repair {
+				parent.addChild(skill.Uid)
+			}
+		}
+	}
+}
+
+/*
+The method checkReachable() checks that every skill can be reached by going
+down the tree from the root - which is not so when skills form a cycle of
+parents. Each skill that cannot be reached is moved to the root.
+*/
+func (checker *integrityChecker) checkReachable() {
+	api := checker.api
+	root, ok := api.skillFromId[api.SkillRoot]
+	if !ok {
+		return
+	}
+	reachable := sets.NewSetOfInt()
+	checker.reach(root, reachable)
+	for _, skill := range checker.skills {
+		if reachable.Contains(skill.Uid) {
+			continue
+		}
+		checker.report("Skill %d cannot be reached from the root", skill.Uid)
+		if !checker.repair {
+			continue
+		}
+		if parent, ok := api.skillFromId[skill.Parent]; ok {
+			parent.removeChild(skill.Uid)
+		}
+		checker.adopt(root, skill)
+		checker.reach(skill, reachable)
+	}
+}
+
+/*
+The method reach() adds the given skill, and those below it, to the reachable
+set. Unlike skillTreeOps.subTree(), it follows only the children that name the
+skill as their parent, and stops at skills already reached, so that it is safe
+to use on a tree that has not been repaired.
+*/
+func (checker *integrityChecker) reach(skill *skillNode,
+	reachable *sets.SetOfInt) {
+	if reachable.Contains(skill.Uid) {
+		return
+	}
+	reachable.Add(skill.Uid)
+	for _, child := range skill.Children {
+		childSkill, ok := checker.api.skillFromId[child]
+		if ok && childSkill.Parent == skill.Uid {
+			checker.reach(childSkill, reachable)
+		}
+	}
+}
+
+// The method adopt() makes the given skill a child of the root.
+func (checker *integrityChecker) adopt(root *skillNode, skill *skillNode) {
+	root.Role = Category
+	skill.Parent = root.Uid
+	root.addChild(skill.Uid)
+}
+
+/*
+The method checkNextSkill() checks that the next Uid to be given out is greater
+than all the Uids in use.
+*/
+func (checker *integrityChecker) checkNextSkill() {
+	api := checker.api
+	highest := 0
+	for _, skill := range checker.skills {
+		if skill.Uid > highest {
+			highest = skill.Uid
+		}
+	}
+	if api.NextSkill <= highest {
+		checker.report("Next skill %d is not above the highest Uid, %d",
+			api.NextSkill, highest)
+		if checker.repair {
+			api.NextSkill = highest + 1
+		}
+	}
+}
+
+/*
+The method checkPeople() checks that every person is listed once, with a known
+role (or else is made a User), and that the people and the UI states match - a
+person without a UI state (or part of one) is given an empty one, and the UI
+state of somebody who is not a person is dropped. The skills named in the UI
+states must exist.
+*/
+func (checker *integrityChecker) checkPeople() {
+	api := checker.api
+	kept := []*person{}
+	for _, pers := range api.People {
+		if pers == nil {
+			checker.report("An empty person is listed")
+			continue
+		}
+		if api.persFromMail[pers.Email] != pers {
+			checker.report("Person %s is listed more than once", pers.Email)
+			continue
+		}
+		kept = append(kept, pers)
+		if pers.Role != User && pers.Role != Admin {
+			checker.report("Person %s has unknown role %q", pers.Email,
+				pers.Role)
+			if checker.repair {
+				pers.Role = User
+			}
+		}
+		if _, ok := api.UiStates[pers.Email]; !ok {
+			checker.report("Person %s has no UI state", pers.Email)
+			if checker.repair {
+				api.UiStates[pers.Email] = newUiState()
+			}
+		}
+	}
+	checker.people = kept
+	if checker.repair {
+		api.People = kept
+	}
+	for _, email := range sortedUiStateKeys(api.UiStates) {
+		uiState := api.UiStates[email]
+		if _, ok := api.persFromMail[email]; !ok {
+			checker.report("UI state for %s, who is not a person", email)
+			if checker.repair {
+				delete(api.UiStates, email)
+			}
+			continue
+		}
+		if uiState == nil {
+			checker.report("Person %s has an empty UI state", email)
+			if checker.repair {
+				api.UiStates[email] = newUiState()
+			}
+			continue
+		}
+		if uiState.CollapsedNodes == nil || uiState.NeedsReview == nil {
+			checker.report("Person %s has an incomplete UI state", email)
+			if checker.repair == false {
+				continue
+			}
+			if uiState.CollapsedNodes == nil {
+				uiState.CollapsedNodes = sets.NewSetOfInt()
+			}
+			if uiState.NeedsReview == nil {
+				uiState.NeedsReview = sets.NewSetOfInt()
+			}
+		}
+		checker.checkSkillSet(uiState.CollapsedNodes,
+			"Collapsed skills of "+email)
+		checker.checkSkillSet(uiState.NeedsReview,
+			"Skills for "+email+" to review")
+	}
+}
+
+// The method checkSkillSet() checks that the skills in the given set exist,
+// and removes those that do not.
+func (checker *integrityChecker) checkSkillSet(set *sets.SetOfInt,
+	what string) {
+	for _, skillId := range set.AsSlice() {
+		if _, ok := checker.api.skillFromId[skillId]; !ok {
+			checker.report("%s include %d, which does not exist", what,
+				skillId)
+			if checker.repair {
+				set.Remove(skillId)
+			}
+		}
+	}
+}
+
+/*
+The method checkHoldings() checks that the skill holdings are the same in both
+directions, and are only of Skills (not Categories) by people. Every person and
+skill must have a (possibly empty) set of holdings. A holding recorded in one
+direction only is completed. Holdings of unknown skills, of categories, or by
+unknown people are removed. When not repairing, the checks are made on copies
+of the maps of holdings, in which missing sets are taken to be empty, so that
+nothing is changed.
+*/
+func (checker *integrityChecker) checkHoldings() {
+	api := checker.api
+	holdings := api.SkillHoldings
+	checker.skillsOf = holdings.SkillsOfPerson
+	checker.peopleWith = holdings.PeopleWithSkill
+	if checker.repair == false {
+		checker.skillsOf = map[string]*sets.SetOfInt{}
+		for email, skills := range holdings.SkillsOfPerson {
+			checker.skillsOf[email] = skills
+		}
+		checker.peopleWith = map[int]*sets.SetOfString{}
+		for skillId, people := range holdings.PeopleWithSkill {
+			checker.peopleWith[skillId] = people
+		}
+	}
+	skillsOf, peopleWith := checker.skillsOf, checker.peopleWith
+	for _, email := range sortedHolderKeys(skillsOf) {
+		if skillsOf[email] == nil {
+			checker.report("Holdings for %s are empty", email)
+			skillsOf[email] = sets.NewSetOfInt()
+		}
+	}
+	for _, skillId := range sortedSkillKeys(peopleWith) {
+		if peopleWith[skillId] == nil {
+			checker.report("Holdings for skill %d are empty", skillId)
+			peopleWith[skillId] = sets.NewSetOfString()
+		}
+	}
+	for _, pers := range checker.people {
+		if _, ok := skillsOf[pers.Email]; !ok {
+			checker.report("Person %s has no holdings", pers.Email)
+			skillsOf[pers.Email] = sets.NewSetOfInt()
+		}
+	}
+	for _, skill := range checker.skills {
+		if _, ok := peopleWith[skill.Uid]; !ok {
+			checker.report("Skill %d has no holdings", skill.Uid)
+			peopleWith[skill.Uid] = sets.NewSetOfString()
+		}
+	}
+	for _, email := range sortedHolderKeys(skillsOf) {
+		if _, ok := api.persFromMail[email]; !ok {
+			checker.report("Holdings for %s, who is not a person", email)
+			if checker.repair {
+				for _, skillId := range skillsOf[email].AsSlice() {
+					holdings.unbind(skillId, email)
+				}
+				delete(skillsOf, email)
+			}
+		}
+	}
+	for _, skillId := range sortedSkillKeys(peopleWith) {
+		if _, ok := api.skillFromId[skillId]; !ok {
+			checker.report("Holdings for skill %d, which does not exist",
+				skillId)
+			if checker.repair {
+				for _, email := range peopleWith[skillId].AsSlice() {
+					holdings.unbind(skillId, email)
+				}
+				delete(peopleWith, skillId)
+			}
+		}
+	}
+	for _, email := range sortedHolderKeys(skillsOf) {
+		skills := skillsOf[email].AsSlice()
+		sort.Ints(skills)
+		for _, skillId := range skills {
+			checker.checkHolding(skillId, email)
+		}
+	}
+	for _, skillId := range sortedSkillKeys(peopleWith) {
+		emails := peopleWith[skillId].AsSlice()
+		sort.Strings(emails)
+		for _, email := range emails {
+			checker.checkHolding(skillId, email)
+		}
+	}
+}
+
+// The method checkHolding() is the part of checkHoldings() that checks one
+// holding.
+func (checker *integrityChecker) checkHolding(skillId int, email string) {
+	api := checker.api
+	holdings := api.SkillHoldings
+	skillsOf, peopleWith := checker.skillsOf, checker.peopleWith
+	skill, skillOk := api.skillFromId[skillId]
+	_, personOk := api.persFromMail[email]
+	switch {
+	case !skillOk || !personOk:
+		checker.report("%s holds skill %d, but one of them does not exist",
+			email, skillId)
+		if checker.repair {
+			holdings.unbind(skillId, email)
+		}
+	case skill.Role == Category:
+		checker.report("%s holds skill %d, which is a category", email,
+			skillId)
+		if checker.repair {
+			holdings.unbind(skillId, email)
+		}
+	case skillsOf[email].Contains(skillId) !=
+		peopleWith[skillId].Contains(email):
+		checker.report("%s holds skill %d in one direction only", email,
+			skillId)
+		if checker.repair {
+			holdings.bind(skillId, email)
+		}
+	}
+}
+
+// The functions sortedUiStateKeys(), sortedHolderKeys() and sortedSkillKeys()
+// provide the keys of the maps they are given, sorted, so that problems are
+// reported in a repeatable order.
+func sortedUiStateKeys(m map[string]*uiState) (keys []string) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+func sortedHolderKeys(m map[string]*sets.SetOfInt) (keys []string) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+func sortedSkillKeys(m map[int]*sets.SetOfString) (keys []int) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return
+}
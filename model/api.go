@@ -93,6 +93,48 @@ func (api *Api) GivePersonSkill(emailName string, skillId int) (err error) {
 	return
 }
 
+/*
+The RemovePersonSkill method is the inverse of GivePersonSkill. It allows a
+person to correct a mistaken claim to have a skill. Errors: UnknownSkill,
+UnknownPerson, NotHeld.
+*/
+func (api *Api) RemovePersonSkill(emailName string, skillId int) (err error) {
+	if api.model.personExists(emailName) == false {
+		err = errors.New(UnknownPerson)
+		return
+	}
+	if api.model.skillExists(skillId) == false {
+		err = errors.New(UnknownSkill)
+		return
+	}
+	if api.model.personHasSkill(skillId, emailName) == false {
+		err = errors.New(NotHeld)
+		return
+	}
+	skill := api.model.skillNode(skillId)
+	api.model.removePersonSkill(skill, emailName)
+	return
+}
+
+/*
+The TogglePersonSkill method gives the person the skill if they do not have
+it, and takes it away if they do. It returns whether the person holds the
+skill afterwards. Errors: UnknownSkill, UnknownPerson.
+*/
+func (api *Api) TogglePersonSkill(emailName string, skillId int) (
+	hasSkill bool, err error) {
+	if hasSkill, err = api.PersonHasSkill(skillId, emailName); err != nil {
+		return
+	}
+	if hasSkill {
+		err = api.RemovePersonSkill(emailName, skillId)
+	} else {
+		err = api.GivePersonSkill(emailName, skillId)
+	}
+	hasSkill = !hasSkill
+	return
+}
+
 //----------------------------------------------------------------------------
 // UiState editing (in model space)
 //----------------------------------------------------------------------------
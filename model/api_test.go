@@ -43,6 +43,35 @@ func TestCollapseNodeToggles(t *testing.T) {
 	testutil.AssertFalse(t, isCollapsed, "TestCollapseNode")
 }
 
+func TestRemovePersonSkill(t *testing.T) {
+	api, skillIds := buildSimpleModel(t)
+	skillAAA := skillIds["skillAAA"]
+	err := api.RemovePersonSkill("fred.bloggs", skillAAA)
+	testutil.AssertNilErr(t, err, "TestRemovePersonSkill")
+	hasSkill, _ := api.PersonHasSkill(skillAAA, "fred.bloggs")
+	testutil.AssertFalse(t, hasSkill, "TestRemovePersonSkill")
+
+	err = api.RemovePersonSkill("fred.bloggs", skillAAA)
+	testutil.AssertErrGenerated(t, err, NotHeld, "TestRemovePersonSkill")
+	err = api.RemovePersonSkill("nosuch.person", skillAAA)
+	testutil.AssertErrGenerated(t, err, UnknownPerson, "TestRemovePersonSkill")
+	err = api.RemovePersonSkill("fred.bloggs", 999)
+	testutil.AssertErrGenerated(t, err, UnknownSkill, "TestRemovePersonSkill")
+}
+
+func TestTogglePersonSkill(t *testing.T) {
+	api, skillIds := buildSimpleModel(t)
+	skillAAA := skillIds["skillAAA"]
+	hasSkill, err := api.TogglePersonSkill("john.smith", skillAAA)
+	testutil.AssertNilErr(t, err, "TestTogglePersonSkill")
+	testutil.AssertTrue(t, hasSkill, "TestTogglePersonSkill")
+	hasSkill, err = api.TogglePersonSkill("john.smith", skillAAA)
+	testutil.AssertNilErr(t, err, "TestTogglePersonSkill")
+	testutil.AssertFalse(t, hasSkill, "TestTogglePersonSkill")
+	hasSkill, _ = api.PersonHasSkill(skillAAA, "john.smith")
+	testutil.AssertFalse(t, hasSkill, "TestTogglePersonSkill")
+}
+
 //-----------------------------------------------------------------------------
 // Helper functions
 //-----------------------------------------------------------------------------
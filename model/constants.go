@@ -8,6 +8,7 @@ const (
 	IllegalForHeldSkill   = "Cannot add child to a <held> skill."
 	IllegalWhenNoChildren = "Cannot do this to a skill without children."
 	IllegalWithRoot       = "Cannot be done with root skill."
+	NotHeld               = "Person does not have this skill."
 	PersonExists          = "Person exists."
 	UnknownPerson         = "Person does not exist."
 	UnknownSkill          = "Skill does not exist."
@@ -48,6 +48,13 @@ func (holdings *holdings) givePersonSkill(skill *skillNode, emailName string) {
 	holdings.peopleWithSkill[skill].Add(emailName)
 }
 
+// Keep this symmetrical with givePersonSkill().
+func (holdings *holdings) removePersonSkill(skill *skillNode,
+	emailName string) {
+	holdings.skillsOfPeople[emailName].RemoveIfPresent(skill.uid)
+	holdings.peopleWithSkill[skill].RemoveIfPresent(emailName)
+}
+
 func (holdings *holdings) someoneHasThisSkill(skill *skillNode) bool {
 	return len(holdings.peopleWithSkill[skill].AsSlice()) != 0
 }
@@ -57,6 +57,10 @@ func (model *model) givePersonSkill(skill *skillNode, emailName string) {
 	model.holdings.givePersonSkill(skill, emailName)
 }
 
+func (model *model) removePersonSkill(skill *skillNode, emailName string) {
+	model.holdings.removePersonSkill(skill, emailName)
+}
+
 //---------------------------------------------------------------------------
 // Query operations
 //---------------------------------------------------------------------------
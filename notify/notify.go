@@ -0,0 +1,145 @@
+/*
+The notify package delivers the notifications that the model queues when
+somebody changes a skill that another person created. The Notifier interface
+is what the Store delivers them to. The MailNotifier emails them (so using a
+mail.MaildirMailer gives a local, file-based implementation that suits
+tests), and the Queue decouples delivery from the caller by doing it in the
+background.
+*/
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"github.com/peterhoward42/skilldrill/mail"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"log"
+	"sync"
+)
+
+// These constants provide a set of human-readable error message strings, with
+// machine-readable names.
+const (
+	QueueClosed = "Notification queue is closed."
+	QueueFull   = "Notification queue is full."
+)
+
+// The Notifier interface is satisfied by anything that can deliver a
+// notification.
+type Notifier interface {
+	Notify(notification model.Notification) error
+}
+
+//----------------------------------------------------------------------------
+// MailNotifier
+//----------------------------------------------------------------------------
+
+/*
+The MailNotifier type delivers notifications by email, using the Mailer. The
+Address function turns the email name that the model uses into the full email
+address to send to (see model.IdentityPolicy.Address()). BaseUrl is used to
+link to the skill in the message.
+*/
+type MailNotifier struct {
+	Mailer  mail.Mailer
+	Address func(name string) (string, error)
+	BaseUrl string
+}
+
+// The method Notify() satisfies the Notifier interface.
+func (notifier *MailNotifier) Notify(notification model.Notification) error {
+	subject := fmt.Sprintf("Your skill \"%s\" has been %s", notification.Title,
+		notification.Change)
+	link := fmt.Sprintf("%s/skill?skill=%d", notifier.BaseUrl,
+		notification.Skill)
+	if notification.Change == model.Removed ||
+		notification.Change == model.Merged {
+		link = notifier.BaseUrl + "/"
+	}
+	address, err := notifier.Address(notification.To)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf(mailBody, notification.Title, notification.Change,
+		notification.Actor, link)
+	return notifier.Mailer.Send(address, subject, body)
+}
+
+var mailBody = `Hello,
+
+The skill "%s", which you added to Skill Drill, has been %s by %s.
+
+%s
+`
+
+//----------------------------------------------------------------------------
+// Queue
+//----------------------------------------------------------------------------
+
+/*
+The Queue type is a Notifier that accepts notifications without waiting for
+them to be delivered, and passes them on to another Notifier in the
+background, one at a time and in order. Delivery failures are logged, since by
+then there is nobody to return them to. Call Close() to deliver any that are
+still queued before exiting.
+*/
+type Queue struct {
+	notifier Notifier
+	pending  chan model.Notification
+	mutex    sync.Mutex
+	closed   bool
+	done     chan bool
+}
+
+// The function NewQueue() is a (compulsory) constructor for a Queue that
+// delivers to the given notifier, and can hold up to size notifications.
+func NewQueue(notifier Notifier, size int) *Queue {
+	queue := &Queue{
+		notifier: notifier,
+		pending:  make(chan model.Notification, size),
+		done:     make(chan bool),
+	}
+	go queue.deliver()
+	return queue
+}
+
+/*
+The method Notify() satisfies the Notifier interface, by queueing the
+notification. It does not wait, and so generates the QueueFull error when the
+queue is full, and the QueueClosed error after Close() has been called.
+*/
+func (queue *Queue) Notify(notification model.Notification) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	if queue.closed {
+		return errors.New(QueueClosed)
+	}
+	select {
+	case queue.pending <- notification:
+		return nil
+	default:
+		return errors.New(QueueFull)
+	}
+}
+
+// The method Close() stops the queue accepting notifications, and waits for
+// those already queued to be delivered.
+func (queue *Queue) Close() {
+	queue.mutex.Lock()
+	if queue.closed == false {
+		queue.closed = true
+		close(queue.pending)
+	}
+	queue.mutex.Unlock()
+	<-queue.done
+}
+
+// The method deliver() is the background loop that empties the queue.
+func (queue *Queue) deliver() {
+	for notification := range queue.pending {
+		if err := queue.notifier.Notify(notification); err != nil {
+			log.Printf("Cannot notify %s: %v", notification.To, err)
+		}
+	}
+	close(queue.done)
+}
@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"errors"
+	"github.com/peterhoward42/skilldrill/mail"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"github.com/peterhoward42/skilldrill/util/testutil"
+	"sync"
+	"testing"
+)
+
+func TestMailNotifier(t *testing.T) {
+	dir := t.TempDir()
+	policy := model.NewIdentityPolicy("example.com")
+	notifier := &MailNotifier{
+		Mailer:  &mail.MaildirMailer{Dir: dir, From: "skilldrill@example.com"},
+		Address: policy.Address,
+		BaseUrl: "http://skilldrill.example.com",
+	}
+	err := notifier.Notify(model.Notification{To: "fred.bloggs",
+		Actor: "john.smith", Skill: 4, Title: "Go", Change: model.Moved})
+	testutil.AssertNilErr(t, err, "Notify")
+
+	messages, err := mail.ReadMaildir(dir)
+	testutil.AssertNilErr(t, err, "Read maildir")
+	testutil.AssertEqInt(t, len(messages), 1, "Number of messages")
+	testutil.AssertStrContains(t, messages[0],
+		"To: fred.bloggs@example.com\r\n", "Message")
+	testutil.AssertStrContains(t, messages[0],
+		"Subject: Your skill \"Go\" has been moved\r\n", "Message")
+	testutil.AssertStrContains(t, messages[0], "moved by john.smith",
+		"Message")
+	testutil.AssertStrContains(t, messages[0],
+		"http://skilldrill.example.com/skill?skill=4", "Message")
+
+	// Without a domain there is no address to send to.
+	notifier.Address = model.NewIdentityPolicy("").Address
+	err = notifier.Notify(model.Notification{To: "fred.bloggs", Skill: 4})
+	testutil.AssertErrGenerated(t, err, model.NoDomain, "Notify no domain")
+	messages, _ = mail.ReadMaildir(dir)
+	testutil.AssertEqInt(t, len(messages), 1, "Nothing sent")
+}
+
+func TestQueue(t *testing.T) {
+	recorder := &recordingNotifier{}
+	queue := NewQueue(recorder, 2)
+	for skill := 1; skill <= 2; skill++ {
+		queue.Notify(model.Notification{To: "fred.bloggs", Skill: skill})
+	}
+	queue.Close()
+	testutil.AssertEqInt(t, len(recorder.received), 2, "Delivered on close")
+	testutil.AssertEqInt(t, recorder.received[1].Skill, 2, "Delivery order")
+	err := queue.Notify(model.Notification{To: "fred.bloggs"})
+	testutil.AssertErrGenerated(t, err, QueueClosed, "Notify after close")
+
+	// A failed delivery does not stop the queue.
+	recorder = &recordingNotifier{fail: true}
+	queue = NewQueue(recorder, 2)
+	queue.Notify(model.Notification{To: "fred.bloggs"})
+	queue.Notify(model.Notification{To: "john.smith"})
+	queue.Close()
+	testutil.AssertEqInt(t, len(recorder.received), 2, "Delivered despite fail")
+}
+
+// The recordingNotifier type is a Notifier that remembers what it is given.
+type recordingNotifier struct {
+	mutex    sync.Mutex
+	received []model.Notification
+	fail     bool
+}
+
+func (recorder *recordingNotifier) Notify(
+	notification model.Notification) error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.received = append(recorder.received, notification)
+	if recorder.fail {
+		return errors.New("Cannot deliver.")
+	}
+	return nil
+}
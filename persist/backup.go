@@ -0,0 +1,314 @@
+package persist
+
+import (
+	"errors"
+	"fmt"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// These constants provide a set of human-readable error message strings, with
+// machine-readable names.
+const (
+	BackupUnverified = "Backup could not be reloaded."
+	UnknownBackup    = "There is no such backup."
+)
+
+// DefaultBackupEvery is how often the Backups take a backup, unless told
+// otherwise.
+const DefaultBackupEvery = time.Hour
+
+// These constants define how the Backups name their files. Names are given
+// to the millisecond, but parsed with backupTimeLayout, which accepts any
+// fraction of a second (or none, as in the names of older backups).
+const (
+	backupPrefix     = "skilldrill-backup-"
+	backupTimeFormat = "20060102T150405.000Z"
+	backupTimeLayout = "20060102T150405Z"
+)
+
+/*
+The RetentionPolicy type says how many backups the Backups keep. The newest
+backup is always kept. Beyond that, the newest backup in each of the most
+recent Hourly hours that have backups is kept, and likewise for the most
+recent Daily days and Weekly weeks. A backup is kept if any of these rules
+keeps it, and the rest are deleted.
+*/
+type RetentionPolicy struct {
+	Hourly int
+	Daily  int
+	Weekly int
+}
+
+// DefaultRetention keeps a day of hourly backups, a week of daily backups and
+// two months or so of weekly backups.
+var DefaultRetention = RetentionPolicy{Hourly: 24, Daily: 7, Weekly: 8}
+
+// The BackupInfo type describes one backup file.
+type BackupInfo struct {
+	Name string
+	Time time.Time
+	Size int64
+}
+
+/*
+The Backups type takes timestamped copies of a Store's Api, made with
+Api.Serialize(), in a directory of their own. Each backup is checked by
+loading it back with model.NewFromSerialized() before it is accepted, and after
+each backup the old ones are pruned according to the Retention policy. A backup
+can be restored into the Store by an admin. Call Start() to take backups in the
+background every Interval, and Close() to stop. The Retention and Interval
+fields must not be changed once Start() has been called.
+*/
+type Backups struct {
+	store     *Store
+	dir       string
+	mutex     sync.Mutex // one backup, prune or restore at a time
+	stop      chan bool
+	done      chan bool
+	now       func() time.Time
+	Interval  time.Duration
+	Retention RetentionPolicy
+}
+
+/*
+The function NewBackups() is a (compulsory) constructor for the Backups of the
+given Store, which are kept in the given directory. The directory is created if
+it does not exist already.
+*/
+func NewBackups(store *Store, dir string) (backups *Backups, err error) {
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	return &Backups{store: store, dir: dir, now: time.Now,
+		Interval: DefaultBackupEvery, Retention: DefaultRetention}, nil
+}
+
+/*
+The method Start() launches the goroutine that takes a backup every Interval.
+Failures are logged, since by then there is nobody to return them to.
+*/
+func (backups *Backups) Start() {
+	backups.stop = make(chan bool)
+	backups.done = make(chan bool)
+	go backups.run()
+}
+
+// The method Close() stops the backups started by Start(), waiting for one
+// that is in progress to finish.
+func (backups *Backups) Close() {
+	if backups.stop == nil {
+		return
+	}
+	close(backups.stop)
+	<-backups.done
+	backups.stop = nil
+}
+
+/*
+The method Backup() takes a backup now, and then prunes the old ones. It
+provides the name of the new backup. A backup that cannot be loaded back
+generates the BackupUnverified error, and is deleted.
+*/
+func (backups *Backups) Backup() (name string, err error) {
+	backups.mutex.Lock()
+	defer backups.mutex.Unlock()
+	if name, err = backups.backup(); err != nil {
+		return
+	}
+	err = backups.prune()
+	return
+}
+
+/*
+The method List() describes the backups that are available, newest first.
+*/
+func (backups *Backups) List() (infos []BackupInfo, err error) {
+	paths, err := filepath.Glob(filepath.Join(backups.dir,
+		backupPrefix+"*"+snapshotSuffix))
+	if err != nil {
+		return
+	}
+	infos = []BackupInfo{}
+	for _, path := range paths {
+		when, ok := backupTime(filepath.Base(path))
+		if !ok {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue // pruned since the Glob
+		}
+		infos = append(infos, BackupInfo{Name: filepath.Base(path),
+			Time: when, Size: stat.Size()})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Time.After(infos[j].Time)
+	})
+	return
+}
+
+/*
+The method Restore() replaces the Store's Api with the one in the named backup
+(see Store.Restore()), on behalf of the given actor, who must be an admin. A
+backup of the Api being replaced is taken first, so that the restore can itself
+be undone. Generates the UnknownBackup error when there is no backup of that
+name.
+*/
+func (backups *Backups) Restore(actor string, name string) (err error) {
+	backups.mutex.Lock()
+	defer backups.mutex.Unlock()
+	if _, ok := backupTime(name); !ok || filepath.Base(name) != name {
+		return errors.New(UnknownBackup)
+	}
+	serialized, err := os.ReadFile(filepath.Join(backups.dir, name))
+	if os.IsNotExist(err) {
+		return errors.New(UnknownBackup)
+	}
+	if err != nil {
+		return
+	}
+	if err = backups.store.requireAdmin(actor); err != nil {
+		return
+	}
+	if _, err = backups.backup(); err != nil {
+		return
+	}
+	return backups.store.Restore(actor, serialized)
+}
+
+//----------------------------------------------------------------------------
+// Module Private Methods
+//----------------------------------------------------------------------------
+
+// The method run() is the background loop started by Start().
+func (backups *Backups) run() {
+	defer close(backups.done)
+	ticker := time.NewTicker(backups.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-backups.stop:
+			return
+		case <-ticker.C:
+			if _, err := backups.Backup(); err != nil {
+				log.Printf("Cannot back up: %v", err)
+			}
+		}
+	}
+}
+
+/*
+The method backup() is the implementation of Backup(), apart from the pruning,
+for use when the lock is already held. An existing backup is never overwritten:
+should the name for the time now be taken already, the time in the name is
+moved on a millisecond at a time until it is free.
+*/
+func (backups *Backups) backup() (name string, err error) {
+	var serialized []byte
+	err = backups.store.Read(func(api *model.Api) (err error) {
+		serialized, err = api.Serialize()
+		return
+	})
+	if err != nil {
+		return
+	}
+	var path string
+	for when := backups.now().UTC(); ; when = when.Add(time.Millisecond) {
+		name = backupPrefix + when.Format(backupTimeFormat) + snapshotSuffix
+		path = filepath.Join(backups.dir, name)
+		if _, statErr := os.Lstat(path); os.IsNotExist(statErr) {
+			break
+		}
+	}
+	if err = writeAtomically(path, serialized); err != nil {
+		return
+	}
+	if err = verifyBackup(path); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return
+}
+
+/*
+The method prune() deletes the backups that the Retention policy does not
+keep. See RetentionPolicy.
+*/
+func (backups *Backups) prune() (err error) {
+	infos, err := backups.List()
+	if err != nil {
+		return
+	}
+	periods := []struct {
+		keep   int
+		bucket func(when time.Time) string
+		seen   map[string]bool
+	}{
+		{backups.Retention.Hourly, func(when time.Time) string {
+			return when.Format("2006010215")
+		}, map[string]bool{}},
+		{backups.Retention.Daily, func(when time.Time) string {
+			return when.Format("20060102")
+		}, map[string]bool{}},
+		{backups.Retention.Weekly, func(when time.Time) string {
+			year, week := when.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}, map[string]bool{}},
+	}
+	for idx, info := range infos {
+		keep := idx == 0
+		for _, period := range periods {
+			bucket := period.bucket(info.Time)
+			if period.seen[bucket] == false && len(period.seen) < period.keep {
+				period.seen[bucket] = true
+				keep = true
+			}
+		}
+		if keep == false {
+			if removeErr := os.Remove(filepath.Join(backups.dir,
+				info.Name)); err == nil {
+				err = removeErr
+			}
+		}
+	}
+	return
+}
+
+// The function verifyBackup() loads the backup file at the given path back
+// into an Api, and generates the BackupUnverified error when that fails, or
+// finds the content has integrity problems.
+func verifyBackup(path string) (err error) {
+	serialized, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	api, err := model.NewFromSerialized(serialized)
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", BackupUnverified, path, err)
+	}
+	if repairs := api.Repairs(); len(repairs) != 0 {
+		return fmt.Errorf("%s %s: %s", BackupUnverified, path,
+			strings.Join(repairs, " "))
+	}
+	return
+}
+
+// The function backupTime() provides the time that the backup of the given
+// name was taken, or false when the name is not that of a backup.
+func backupTime(name string) (when time.Time, ok bool) {
+	if strings.HasPrefix(name, backupPrefix) == false ||
+		strings.HasSuffix(name, snapshotSuffix) == false {
+		return
+	}
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix),
+		snapshotSuffix)
+	when, err := time.Parse(backupTimeLayout, stamp)
+	return when, err == nil
+}
@@ -0,0 +1,129 @@
+package persist
+
+import (
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"github.com/peterhoward42/skilldrill/util/testutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	doSimpleCommands(t, store)
+	store.Do(&Command{Op: OpGrantAdmin, Email: "fred.bloggs"})
+	backups, clock := newTestBackups(t, store, dir)
+	name, err := backups.Backup()
+	testutil.AssertNilErr(t, err, "Backup")
+
+	// Change the model, and then restore the backup.
+	*clock = clock.Add(time.Minute)
+	err = store.Do(&Command{Op: OpRemovePersonSkill, Email: "fred.bloggs",
+		SkillId: 2})
+	testutil.AssertNilErr(t, err, "Change after backup")
+	err = backups.Restore("john.smith", name)
+	testutil.AssertErrGenerated(t, err, model.PermissionDenied,
+		"Restore by non admin")
+	err = backups.Restore("fred.bloggs", "skilldrill-backup-nonsense.yaml")
+	testutil.AssertErrGenerated(t, err, UnknownBackup, "Restore unknown")
+	err = backups.Restore("fred.bloggs", "../"+name)
+	testutil.AssertErrGenerated(t, err, UnknownBackup, "Restore outside")
+	err = backups.Restore("fred.bloggs", name)
+	testutil.AssertNilErr(t, err, "Restore")
+	checkSimpleCommands(t, store.api)
+
+	// The model replaced should have been backed up, and the restore kept.
+	infos, _ := backups.List()
+	testutil.AssertEqInt(t, len(infos), 2, "Backup before restore")
+	testutil.AssertEqString(t, infos[1].Name, name, "Newest first")
+
+	// A backup in the same instant as another gets a name of its own (this
+	// is before pruning, which would keep only one of them).
+	latest := infos[0].Name
+	again, err := backups.backup()
+	testutil.AssertNilErr(t, err, "Backup in the same instant")
+	testutil.AssertTrue(t, again != latest, "Existing backup kept")
+	infos, _ = backups.List()
+	testutil.AssertEqInt(t, len(infos), 3, "Backups kept")
+	testutil.AssertEqString(t, infos[1].Name, latest, "Still in order")
+	store.Close()
+	store = openStore(t, dir)
+	defer store.Close()
+	checkSimpleCommands(t, store.api)
+}
+
+func TestBackupRetention(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	defer store.Close()
+	doSimpleCommands(t, store)
+	backups, clock := newTestBackups(t, store, dir)
+	backups.Retention = RetentionPolicy{Hourly: 3, Daily: 2, Weekly: 3}
+
+	// A backup every hour for a fortnight.
+	start := *clock
+	for *clock = start; clock.Sub(start) <= 14*24*time.Hour; {
+		_, err := backups.Backup()
+		testutil.AssertNilErr(t, err, "Backup")
+		*clock = clock.Add(time.Hour)
+	}
+	infos, _ := backups.List()
+	kept := map[string]bool{}
+	for _, info := range infos {
+		kept[info.Time.Format("0102 15:04")] = true
+	}
+	// The last backup is 2015-06-15 00:00 (a Monday).
+	expected := []string{
+		"0615 00:00", // newest; newest this hour, day and week
+		"0614 23:00", // hour before; day before; week before
+		"0614 22:00", // hour before that
+		"0607 23:00", // week before that
+	}
+	for _, when := range expected {
+		testutil.AssertTrue(t, kept[when], "Kept "+when)
+	}
+	testutil.AssertEqInt(t, len(infos), len(expected), "Number kept")
+}
+
+func TestUnverifiedBackupRemoved(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	defer store.Close()
+	backups, _ := newTestBackups(t, store, dir)
+	os.WriteFile(filepath.Join(dir, "backups",
+		"skilldrill-backup-20150601T000000Z.yaml"), []byte("[[["), 0600)
+	err := verifyBackup(filepath.Join(dir, "backups",
+		"skilldrill-backup-20150601T000000Z.yaml"))
+	testutil.AssertErrGenerated(t, err, BackupUnverified, "Garbage backup")
+	_, err = backups.Backup()
+	testutil.AssertNilErr(t, err, "Backup of empty model")
+}
+
+func TestOlderBackupNamesListed(t *testing.T) {
+	when, ok := backupTime("skilldrill-backup-20150601T000000Z.yaml")
+	testutil.AssertTrue(t, ok, "Name to the second")
+	testutil.AssertTrue(t, when.Equal(time.Date(2015, 6, 1, 0, 0, 0, 0,
+		time.UTC)), "Time to the second")
+	when, ok = backupTime("skilldrill-backup-20150601T000000.250Z.yaml")
+	testutil.AssertTrue(t, ok, "Name to the millisecond")
+	testutil.AssertTrue(t, when.Equal(time.Date(2015, 6, 1, 0, 0, 0, 250e6,
+		time.UTC)), "Time to the millisecond")
+}
+
+//-----------------------------------------------------------------------------
+// Helper functions
+//-----------------------------------------------------------------------------
+
+// The function newTestBackups() makes Backups for the given store, in a
+// subdirectory of the given dir, whose clock is under the test's control.
+func newTestBackups(t *testing.T, store *Store, dir string) (
+	backups *Backups, clock *time.Time) {
+	backups, err := NewBackups(store, filepath.Join(dir, "backups"))
+	testutil.AssertNilErr(t, err, "New backups")
+	when := time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	clock = &when
+	backups.now = func() time.Time { return *clock }
+	return
+}
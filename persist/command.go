@@ -0,0 +1,215 @@
+package persist
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/peterhoward42/skilldrill/audit"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+)
+
+// These constants name the mutating Api operations that a Command can carry.
+const (
+	OpAddPerson         = "AddPerson"
+	OpAddSkill          = "AddSkill"
+	OpGivePersonSkill   = "GivePersonSkill"
+	OpRemovePersonSkill = "RemovePersonSkill"
+	OpTogglePersonSkill = "TogglePersonSkill"
+	OpCollapseSkill     = "CollapseSkill"
+	OpExpandSkill       = "ExpandSkill"
+	OpSetSkillTitle     = "SetSkillTitle"
+	OpSetSkillDesc      = "SetSkillDesc"
+	OpSetSkillWording   = "SetSkillWording"
+	OpReParentSkill     = "ReParentSkill"
+	OpRemovePerson      = "RemovePerson"
+	OpRemoveSkill       = "RemoveSkill"
+	OpGrantAdmin        = "GrantAdmin"
+	OpRevokeAdmin       = "RevokeAdmin"
+	OpMergeSkills       = "MergeSkills"
+	OpSplitSkill        = "SplitSkill"
+	OpDismissReview     = "DismissReview"
+	OpSetSkillRole      = "SetSkillRole"
+	OpUndo              = "Undo"
+	OpRedo              = "Redo"
+)
+
+/*
+The Command type is a record of one call to a mutating Api method, in terms of
+the operation (one of the Op constants) and the parameters that were passed.
+Only the fields relevant to the operation are used. The Actor is the person
+making the change. Other is the second skill, for operations that involve two
+(for MergeSkills it is the skill absorbed into SkillId). Children and Reassign
+are the parameters of SplitSkill, and Review is the reviewHolders parameter of
+SetSkillRole. Commands are what the Store writes to its journal, and replays
+on startup. The NewUid field holds the Uid that AddSkill generated (or the
+first of those SplitSkill generated), so that replay can check it is
+deterministic.
+*/
+type Command struct {
+	Op       string           `json:"op"`
+	Actor    string           `json:"actor,omitempty"`
+	Email    string           `json:"email,omitempty"`
+	SkillId  int              `json:"skill,omitempty"`
+	Role     string           `json:"role,omitempty"`
+	Title    string           `json:"title,omitempty"`
+	Desc     string           `json:"desc,omitempty"`
+	Parent   int              `json:"parent,omitempty"`
+	Other    int              `json:"other,omitempty"`
+	Children []model.NewChild `json:"children,omitempty"`
+	Reassign map[string]int   `json:"reassign,omitempty"`
+	Review   bool             `json:"review,omitempty"`
+	NewUid   int              `json:"newuid,omitempty"`
+}
+
+/*
+The method Apply() makes the Api call that the command represents. The errors
+generated are those of the Api method concerned, with the addition of
+UnknownOperation, and ReplayDiverged - which is generated when an AddSkill
+or SplitSkill command produces a different Uid to that recorded. (In which
+case the change has nonetheless been made.)
+*/
+func (cmd *Command) Apply(api *model.Api) (err error) {
+	switch cmd.Op {
+	case OpAddPerson:
+		err = api.AddPerson(cmd.Email)
+	case OpAddSkill:
+		var uid int
+		uid, err = api.AddSkill(cmd.Actor, cmd.Role, cmd.Title, cmd.Desc,
+			cmd.Parent)
+		if err != nil {
+			return
+		}
+		err = cmd.checkNewUid(uid)
+	case OpGivePersonSkill:
+		err = api.GivePersonSkill(cmd.Email, cmd.SkillId)
+	case OpRemovePersonSkill:
+		err = api.RemovePersonSkill(cmd.Email, cmd.SkillId)
+	case OpTogglePersonSkill:
+		_, err = api.TogglePersonSkill(cmd.Email, cmd.SkillId)
+	case OpCollapseSkill:
+		err = api.CollapseSkill(cmd.Email, cmd.SkillId)
+	case OpExpandSkill:
+		err = api.ExpandSkill(cmd.Email, cmd.SkillId)
+	case OpSetSkillTitle:
+		err = api.SetSkillTitle(cmd.Actor, cmd.SkillId, cmd.Title)
+	case OpSetSkillDesc:
+		err = api.SetSkillDesc(cmd.Actor, cmd.SkillId, cmd.Desc)
+	case OpSetSkillWording:
+		err = api.SetSkillWording(cmd.Actor, cmd.SkillId, cmd.Title, cmd.Desc)
+	case OpReParentSkill:
+		err = api.ReParentSkill(cmd.Actor, cmd.SkillId, cmd.Parent)
+	case OpRemovePerson:
+		err = api.RemovePerson(cmd.Actor, cmd.Email)
+	case OpRemoveSkill:
+		err = api.RemoveSkill(cmd.Actor, cmd.SkillId)
+	case OpGrantAdmin:
+		err = api.GrantAdmin(cmd.Actor, cmd.Email)
+	case OpRevokeAdmin:
+		err = api.RevokeAdmin(cmd.Actor, cmd.Email)
+	case OpMergeSkills:
+		err = api.MergeSkills(cmd.Actor, cmd.SkillId, cmd.Other)
+	case OpSplitSkill:
+		var uids []int
+		uids, err = api.SplitSkill(cmd.Actor, cmd.SkillId, cmd.Children,
+			cmd.Reassign)
+		if err != nil {
+			return
+		}
+		err = cmd.checkNewUid(uids[0])
+	case OpSetSkillRole:
+		err = api.SetSkillRole(cmd.Actor, cmd.SkillId, cmd.Role, cmd.Review)
+	case OpDismissReview:
+		err = api.DismissReview(cmd.Email, cmd.SkillId)
+	case OpUndo:
+		err = api.Undo(cmd.Actor)
+	case OpRedo:
+		err = api.Redo(cmd.Actor)
+	default:
+		err = errors.New(UnknownOperation)
+	}
+	return
+}
+
+/*
+The method normalise() replaces the email addresses in the command (the Actor,
+the Email and the keys of Reassign) with the names the given Api knows those
+people by (see Api.NormaliseEmail()). This is done before the command is
+journaled, so that replaying the journal gives the same result however the
+identity policy has been configured since. An address that cannot be
+normalised is left as it is, for the Api method to reject.
+*/
+func (cmd *Command) normalise(api *model.Api) {
+	for _, email := range []*string{&cmd.Actor, &cmd.Email} {
+		if name, err := api.NormaliseEmail(*email); err == nil {
+			*email = name
+		}
+	}
+	if cmd.Reassign == nil {
+		return
+	}
+	reassign := map[string]int{}
+	for email, childIdx := range cmd.Reassign {
+		if name, err := api.NormaliseEmail(email); err == nil {
+			email = name
+		}
+		reassign[email] = childIdx
+	}
+	cmd.Reassign = reassign
+}
+
+/*
+The method auditEntry() makes the audit log entry for the command, given the
+error that applying it generated. The actor is the person the command was
+made for, when it has no Actor of its own. The people are recorded by the
+names the given Api knows them by (see Api.NormaliseEmail()), so that the
+entries can be found however the email addresses were typed.
+*/
+func (cmd *Command) auditEntry(api *model.Api, err error) (
+	entry audit.Entry) {
+	entry = audit.Entry{Actor: cmd.Actor, Op: cmd.Op, Person: cmd.Email}
+	if entry.Actor == "" {
+		entry.Actor = cmd.Email
+	}
+	for _, email := range []*string{&entry.Actor, &entry.Person} {
+		if name, err := api.NormaliseEmail(*email); err == nil {
+			*email = name
+		}
+	}
+	entry.Args, _ = json.Marshal(cmd)
+	entry.Skills = cmd.skillsInvolved()
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return
+}
+
+/*
+The method skillsInvolved() provides the Uids of the skills that the command
+concerns - including any that it created, and the parent it gave a skill.
+*/
+func (cmd *Command) skillsInvolved() (skills []int) {
+	for _, skillId := range []int{cmd.SkillId, cmd.Other} {
+		if skillId > 0 {
+			skills = append(skills, skillId)
+		}
+	}
+	if (cmd.Op == OpAddSkill || cmd.Op == OpReParentSkill) && cmd.Parent > 0 {
+		skills = append(skills, cmd.Parent)
+	}
+	if cmd.NewUid > 0 {
+		skills = append(skills, cmd.NewUid)
+		for idx := 1; idx < len(cmd.Children); idx++ {
+			skills = append(skills, cmd.NewUid+idx)
+		}
+	}
+	return
+}
+
+// The method checkNewUid() records the given Uid as the one the command
+// generated, or when one was recorded already, checks that it is the same.
+func (cmd *Command) checkNewUid(uid int) (err error) {
+	if cmd.NewUid != 0 && cmd.NewUid != uid {
+		return errors.New(ReplayDiverged)
+	}
+	cmd.NewUid = uid
+	return
+}
@@ -0,0 +1,71 @@
+package persist
+
+import (
+	"fmt"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"github.com/peterhoward42/skilldrill/util/testutil"
+	"sync"
+	"testing"
+)
+
+/*
+This test hammers the Store from many goroutines at once, with a mixture of
+commands and queries. It is only really meaningful when run with the race
+detector (go test -race), which will report any access to the Api that is not
+properly guarded.
+*/
+func TestConcurrentUse(t *testing.T) {
+	store := openStore(t, t.TempDir())
+	defer store.Close()
+	store.CompactEvery = 50
+	doSimpleCommands(t, store)
+
+	const workers = 8
+	const iterations = 25
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(3)
+		email := fmt.Sprintf("person.%d", worker)
+		go func() {
+			defer wg.Done()
+			store.Do(&Command{Op: OpAddPerson, Email: email})
+			for i := 0; i < iterations; i++ {
+				store.Do(&Command{Op: OpGivePersonSkill, Email: email,
+					SkillId: 2})
+				store.Do(&Command{Op: OpTogglePersonSkill, Email: email,
+					SkillId: 2})
+			}
+		}()
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				store.Do(&Command{Op: OpAddSkill, Role: model.Skill,
+					Title: fmt.Sprintf("Skill %d %d", worker, i),
+					Desc:  "desc", Parent: 1})
+			}
+		}(worker)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				store.Read(func(api *model.Api) error {
+					skills, _, err := api.EnumerateTree("fred.bloggs")
+					for _, skill := range skills {
+						api.SkillWording(skill)
+					}
+					return err
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	store.Read(func(api *model.Api) error {
+		skills, _, err := api.EnumerateTree("fred.bloggs")
+		testutil.AssertNilErr(t, err, "Enumerate after concurrent use")
+		testutil.AssertEqInt(t, len(skills), 2+workers*iterations,
+			"Skills after concurrent use")
+		people, _ := api.PeopleWithSkill(2)
+		testutil.AssertEqInt(t, len(people), 1, "Holders after concurrent use")
+		return nil
+	})
+}
@@ -0,0 +1,99 @@
+package persist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+/*
+The journal type is an append-only file of Commands, one JSON object per line.
+Each append is flushed to disk before it returns, so that once a Command has
+been journaled, it survives a crash. A crash part way through an append can
+only leave an incomplete last line, which is ignored when the journal is read.
+*/
+type journal struct {
+	path  string
+	file  *os.File
+	count int // number of commands in the journal
+}
+
+/*
+The function openJournal() opens the journal at the given path for appending,
+creating it if necessary. It returns the commands already in the journal so
+that the caller can replay them.
+*/
+func openJournal(path string) (jnl *journal, commands []*Command, err error) {
+	commands, length, err := readJournal(path)
+	if err != nil {
+		return
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	// Position after the last complete line, discarding any incomplete one.
+	if err = file.Truncate(length); err == nil {
+		_, err = file.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		file.Close()
+		return
+	}
+	jnl = &journal{path: path, file: file, count: len(commands)}
+	return
+}
+
+// The method append() adds the given command to the end of the journal.
+func (jnl *journal) append(cmd *Command) (err error) {
+	line, err := json.Marshal(cmd)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	if _, err = jnl.file.Write(line); err != nil {
+		return
+	}
+	if err = jnl.file.Sync(); err != nil {
+		return
+	}
+	jnl.count++
+	return
+}
+
+func (jnl *journal) close() error {
+	return jnl.file.Close()
+}
+
+/*
+The function readJournal() reads all the complete commands in the journal file
+at the given path, and reports the length of the file that they occupy. A
+journal that does not exist is treated as being empty. A complete line that
+cannot be decoded generates the CorruptJournal error.
+*/
+func readJournal(path string) (commands []*Command, length int64, err error) {
+	commands = []*Command{}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return commands, 0, nil
+	}
+	if err != nil {
+		return
+	}
+	content = content[:bytes.LastIndexByte(content, '\n')+1]
+	for lineNo, line := range bytes.SplitAfter(content, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		cmd := &Command{}
+		if err = json.Unmarshal(line, cmd); err != nil {
+			err = fmt.Errorf("%s %s line %d: %v", CorruptJournal, path,
+				lineNo+1, err)
+			return nil, 0, err
+		}
+		commands = append(commands, cmd)
+	}
+	return commands, int64(len(content)), nil
+}
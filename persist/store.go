@@ -0,0 +1,505 @@
+/*
+The persist package is responsible for keeping the skilldrill model safe on
+disk. The Store type owns the in-memory Api while the server runs, and is safe
+for concurrent use. Every mutating operation is made by passing a Command to
+the Store, which applies it to the Api and records it in an append-only
+journal. Queries are made by passing a function to the Store's Read() method.
+Periodically the journal is compacted into a snapshot made with
+Api.Serialize(). On startup the latest snapshot is loaded and the journal that
+follows it is replayed.
+*/
+package persist
+
+import (
+	"errors"
+	"fmt"
+	"github.com/peterhoward42/skilldrill/audit"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"github.com/peterhoward42/skilldrill/notify"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// These constants provide a set of human-readable error message strings, with
+// machine-readable names.
+const (
+	CorruptDataFile  = "Data file is corrupt."
+	CorruptJournal   = "Journal is corrupt."
+	ReplayDiverged   = "Journal replay produced a different result."
+	StoreFailed      = "Store has failed, and must be reopened."
+	UnknownOperation = "Unknown operation."
+)
+
+// RestoreOp is the operation recorded in the audit log when the Api is
+// replaced by Restore().
+const RestoreOp = "Restore"
+
+// DefaultCompactEvery is the number of journaled commands after which the
+// Store compacts the journal into a new snapshot.
+const DefaultCompactEvery = 500
+
+// These constants define how the Store names the files in its data directory.
+const (
+	filePrefix     = "skilldrill-"
+	snapshotSuffix = ".yaml"
+	journalSuffix  = ".journal"
+	tempSuffix     = ".tmp"
+)
+
+/*
+The Store type keeps an Api in a data directory, in the form of numbered
+generations. Each generation is a snapshot file holding the serialized Api, and
+a journal file holding the commands made since the snapshot was taken. A new
+generation is started by writing its snapshot atomically (write a temporary
+file, flush it to disk and rename it), so a crash at any point leaves a
+complete generation to start from. The previous generation is kept as a
+last-good copy, so that if the current snapshot is ever found to be corrupt,
+the last-good copy is available to fall back on by hand. The Api is guarded by
+a reader/writer lock, so that any number of goroutines may read it at once, but
+commands are applied one at a time, and never while somebody is reading. The
+optional Configure function is called with the Api once it has been built, to
+set up the Api configuration that is not part of the data (such as its
+IdentityPolicy). It is called after the journal has been replayed, because the
+journal records people by their normalised names (see Command.normalise()), so
+that replay does not depend on the configuration. The optional Notifier is
+given the notifications that the Api queues as commands are applied - but not
+those queued while replaying the journal, since they were delivered first time
+round. Likewise, the optional Audit log is given an entry for every command
+passed to Do() (whether or not it succeeds), and for every Restore() - but not
+for the commands replayed.
+*/
+type Store struct {
+	mutex        sync.RWMutex
+	dir          string
+	api          *model.Api
+	generation   int
+	journal      *journal
+	repairs      []string // made to the snapshot when it was loaded
+	failed       error    // why the Store refuses commands, if it does
+	CompactEvery int
+	Configure    func(api *model.Api)
+	Notifier     notify.Notifier
+	Audit        *audit.Log
+}
+
+/*
+The function NewStore() is a (compulsory) constructor for a Store that keeps
+its files in the given directory. The directory is created if it does not
+exist already. Call Open() before using the Store.
+*/
+func NewStore(dir string) (store *Store, err error) {
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	return &Store{dir: dir, CompactEvery: DefaultCompactEvery}, nil
+}
+
+/*
+The method Open() builds the Api from the latest snapshot and replays the
+journal that follows it. When the directory holds no snapshot yet, the Api
+starts out empty. A snapshot that cannot be de-serialized generates the
+CorruptDataFile error, and a journal that cannot be replayed generates
+CorruptJournal or ReplayDiverged. In these cases the files are deliberately
+left untouched - including the last-good copy - so that a human can decide what
+to do.
+*/
+func (store *Store) Open() (err error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.generation, err = store.latestGeneration(); err != nil {
+		return
+	}
+	api, jnl, err := store.load()
+	if err != nil {
+		return
+	}
+	store.repairs = api.Repairs()
+	store.api = api
+	store.journal = jnl
+	store.failed = nil
+	return
+}
+
+/*
+The method Read() calls the given function with the Api, holding a read lock
+for the duration of the call. The function must not change the Api, and must
+not retain it after returning. The function's error is returned.
+*/
+func (store *Store) Read(query func(api *model.Api) error) error {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return query(store.api)
+}
+
+/*
+The method Do() applies the given command to the Api, and when it succeeds,
+records it in the journal. When the command fails, the model is unchanged and
+nothing is recorded. Should the journal fail to record a command that has been
+applied, the Api is rebuilt from the files (see rollback()), so that it is
+unchanged then too. After every CompactEvery commands, the journal is
+compacted into a new snapshot. Any notifications the command caused are then
+given to the Notifier, once the lock has been released. Note that if the
+compaction, the audit or a notification fails, the error is returned, but the
+command itself has still been applied and journaled.
+*/
+func (store *Store) Do(cmd *Command) (err error) {
+	notifications, err := store.do(cmd)
+	if store.Notifier == nil {
+		return
+	}
+	for _, notification := range notifications {
+		if notifyErr := store.Notifier.Notify(notification); err == nil {
+			err = notifyErr
+		}
+	}
+	return
+}
+
+/*
+The method Save() starts a new generation, by writing a snapshot of the Api and
+starting an empty journal to follow it. Generations older than the last-good
+one are then deleted. The Api's undo history is forgotten, because it is not
+part of the snapshot, and the Undo and Redo commands in the new journal must
+replay against the same history as they were made with.
+*/
+func (store *Store) Save() (err error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.save()
+}
+
+/*
+The method Verify() checks the integrity of the Api (see Api.Verify()), and
+describes the problems found. These include any that were repaired in memory
+when the snapshot was loaded, since they are still present on disk. When repair
+is true, the problems are put right, and a new generation is saved so that the
+repairs are kept.
+*/
+func (store *Store) Verify(repair bool) (problems []string, err error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	problems = append([]string{}, store.repairs...)
+	problems = append(problems, store.api.Verify(repair)...)
+	if repair && len(problems) != 0 {
+		if err = store.save(); err != nil {
+			return
+		}
+		store.repairs = []string{}
+	}
+	return
+}
+
+/*
+The method Restore() replaces the Api with the one serialized in the given
+content (such as a backup), on behalf of the given actor, who must be an admin.
+The replacement starts a new generation, so the previous one remains as the
+last-good copy. Generates the model's PermissionDenied error when the actor is
+not an admin, and CorruptDataFile when the content cannot be de-serialized.
+*/
+func (store *Store) Restore(actor string, serialized []byte) (err error) {
+	api, err := model.NewFromSerialized(serialized)
+	if err != nil {
+		return fmt.Errorf("%s %v", CorruptDataFile, err)
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.api.IsAdmin(actor) == false {
+		err = errors.New(model.PermissionDenied)
+	} else {
+		err = store.replace(api)
+	}
+	entry := audit.Entry{Actor: actor, Op: RestoreOp}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if auditErr := store.audit(entry); err == nil {
+		err = auditErr
+	}
+	return
+}
+
+// The method Close() releases the journal file.
+func (store *Store) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.journal.close()
+}
+
+// The method LastGoodFile() provides the path of the last-good copy of the
+// snapshot.
+func (store *Store) LastGoodFile() string {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.lastGoodFile()
+}
+
+//----------------------------------------------------------------------------
+// Module Private Methods
+//----------------------------------------------------------------------------
+
+/*
+The method do() is the implementation of Do(), apart from the delivery of the
+notifications, which it returns. The command is audited only once its fate is
+known - so after it has been journaled - and with the error that stopped it
+from being applied or journaled, if any.
+*/
+func (store *Store) do(cmd *Command) (notifications []model.Notification,
+	err error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.failed != nil {
+		return nil, fmt.Errorf("%s %v", StoreFailed, store.failed)
+	}
+	cmd.normalise(store.api)
+	if err = cmd.Apply(store.api); err == nil {
+		if err = store.journal.append(cmd); err != nil {
+			store.rollback()
+		}
+	}
+	notifications = store.api.TakeNotifications()
+	auditErr := store.audit(cmd.auditEntry(store.api, err))
+	if err != nil {
+		return
+	}
+	if store.journal.count >= store.CompactEvery {
+		err = store.save()
+	}
+	if err == nil {
+		err = auditErr
+	}
+	return
+}
+
+/*
+The method rollback() undoes a command that has been applied but could not be
+journaled, by rebuilding the Api from the snapshot and the journal, as Open()
+does. (The journal is reopened, which discards anything the failed append
+left behind.) If the Api cannot be rebuilt, the Store is marked as failed, and
+refuses further commands (and saves) until it is reopened.
+*/
+func (store *Store) rollback() {
+	store.journal.close()
+	api, jnl, err := store.load()
+	if err != nil {
+		store.failed = err
+		return
+	}
+	store.api = api
+	store.journal = jnl
+}
+
+// The method save() is the implementation of Save(), for use when the lock is
+// already held.
+func (store *Store) save() (err error) {
+	if store.failed != nil {
+		return fmt.Errorf("%s %v", StoreFailed, store.failed)
+	}
+	serialized, err := store.api.Serialize()
+	if err != nil {
+		return
+	}
+	next := store.generation + 1
+	if err = writeAtomically(store.snapshotFile(next),
+		serialized); err != nil {
+		return
+	}
+	// Any journal left over from an earlier failed attempt is not valid.
+	os.Remove(store.journalFile(next))
+	jnl, _, err := openJournal(store.journalFile(next))
+	if err != nil {
+		return
+	}
+	store.api.ForgetUndoHistory()
+	store.journal.close()
+	store.journal = jnl
+	store.generation = next
+	store.removeGeneration(next - 2)
+	return
+}
+
+// The method replace() is the implementation of Restore(), once the Api has
+// been built and the actor checked.
+func (store *Store) replace(api *model.Api) (err error) {
+	if store.Configure != nil {
+		store.Configure(api)
+	}
+	replaced := store.api
+	store.api = api
+	if err = store.save(); err != nil {
+		store.api = replaced
+		return
+	}
+	store.repairs = api.Repairs()
+	return
+}
+
+// The method audit() records the given entry in the audit log, when there is
+// one.
+func (store *Store) audit(entry audit.Entry) error {
+	if store.Audit == nil {
+		return nil
+	}
+	return store.Audit.Record(entry)
+}
+
+/*
+The method load() builds the Api from the snapshot of the current generation,
+replays the journal that follows the snapshot, and then configures the Api.
+The journal is returned open for appending.
+*/
+func (store *Store) load() (api *model.Api, jnl *journal, err error) {
+	if api, err = store.loadSnapshot(); err != nil {
+		return
+	}
+	jnl, commands, err := openJournal(store.journalFile(store.generation))
+	if err != nil {
+		return
+	}
+	for idx, cmd := range commands {
+		if err = cmd.Apply(api); err != nil {
+			jnl.close()
+			err = fmt.Errorf("%s %s command %d (%s): %v", CorruptJournal,
+				jnl.path, idx+1, cmd.Op, err)
+			return nil, nil, err
+		}
+	}
+	api.TakeNotifications()
+	if store.Configure != nil {
+		store.Configure(api)
+	}
+	return
+}
+
+/*
+The method loadSnapshot() builds an Api from the snapshot of the current
+generation. Generation zero has no snapshot, and is an empty Api.
+*/
+func (store *Store) loadSnapshot() (api *model.Api, err error) {
+	if store.generation == 0 {
+		return model.NewApi(), nil
+	}
+	path := store.snapshotFile(store.generation)
+	serialized, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	api, err = model.NewFromSerialized(serialized)
+	if err != nil {
+		err = fmt.Errorf("%s %s: %v (the last good copy is in: %s)",
+			CorruptDataFile, path, err, store.lastGoodFile())
+		return nil, err
+	}
+	return
+}
+
+// The method latestGeneration() finds the highest numbered snapshot in the
+// directory, or zero if there are none.
+func (store *Store) latestGeneration() (generation int, err error) {
+	generations, err := store.generations()
+	if err != nil || len(generations) == 0 {
+		return
+	}
+	return generations[len(generations)-1], nil
+}
+
+// The method generations() provides the numbers of the snapshots in the
+// directory in ascending order.
+func (store *Store) generations() (generations []int, err error) {
+	pattern := filepath.Join(store.dir, filePrefix+"*"+snapshotSuffix)
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return
+	}
+	generations = []int{}
+	for _, path := range paths {
+		var generation int
+		_, scanErr := fmt.Sscanf(filepath.Base(path),
+			filePrefix+"%d"+snapshotSuffix, &generation)
+		if scanErr == nil {
+			generations = append(generations, generation)
+		}
+	}
+	sort.Ints(generations)
+	return
+}
+
+// The method removeGeneration() deletes the files of the given generation.
+func (store *Store) removeGeneration(generation int) {
+	os.Remove(store.snapshotFile(generation))
+	os.Remove(store.journalFile(generation))
+}
+
+// The method requireAdmin() generates the model's PermissionDenied error
+// unless the given actor is an admin.
+func (store *Store) requireAdmin(actor string) (err error) {
+	store.Read(func(api *model.Api) error {
+		if api.IsAdmin(actor) == false {
+			err = errors.New(model.PermissionDenied)
+		}
+		return nil
+	})
+	return
+}
+
+func (store *Store) lastGoodFile() string {
+	return store.snapshotFile(store.generation - 1)
+}
+
+func (store *Store) snapshotFile(generation int) string {
+	return store.generationFile(generation, snapshotSuffix)
+}
+
+func (store *Store) journalFile(generation int) string {
+	return store.generationFile(generation, journalSuffix)
+}
+
+func (store *Store) generationFile(generation int, suffix string) string {
+	name := fmt.Sprintf("%s%06d%s", filePrefix, generation, suffix)
+	return filepath.Join(store.dir, name)
+}
+
+/*
+The function writeAtomically() replaces the content of the given file with the
+given bytes, such that a reader (or a crash) will see either the old content
+or the new content, but never a mixture.
+*/
+func writeAtomically(path string, content []byte) (err error) {
+	tempPath := path + tempSuffix
+	file, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
+		0600)
+	if err != nil {
+		return
+	}
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return
+	}
+	if err = os.Rename(tempPath, path); err != nil {
+		return
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// The function syncDir() flushes the entries (i.e. the renames) of the given
+// directory to disk.
+func syncDir(path string) (err error) {
+	if runtime.GOOS == "windows" {
+		return // Windows cannot sync a directory, and has no need to.
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,429 @@
+package persist
+
+import (
+	"github.com/peterhoward42/skilldrill/audit"
+	"github.com/peterhoward42/skilldrill/model-hidden"
+	"github.com/peterhoward42/skilldrill/util/testutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenEmptyDir(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "newdir"))
+	testutil.AssertNilErr(t, err, "New store")
+	err = store.Open()
+	testutil.AssertNilErr(t, err, "Open empty dir")
+	defer store.Close()
+	testutil.AssertFalse(t, store.api.PersonExists("fred.bloggs"),
+		"Open empty dir")
+}
+
+func TestReplayJournal(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	doSimpleCommands(t, store)
+	store.Close()
+
+	// A fresh store on the same directory should replay the commands.
+	store = openStore(t, dir)
+	defer store.Close()
+	checkSimpleCommands(t, store.api)
+	testutil.AssertEqInt(t, store.generation, 0, "Generation")
+}
+
+func TestFailedCommandsNotJournaled(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	doSimpleCommands(t, store)
+	err := store.Do(&Command{Op: OpAddPerson, Email: "fred.bloggs"})
+	testutil.AssertErrGenerated(t, err, model.PersonExists, "Failed command")
+	err = store.Do(&Command{Op: "Nonsense"})
+	testutil.AssertErrGenerated(t, err, UnknownOperation, "Failed command")
+	store.Close()
+
+	// Replay would fail if the failed command had been journaled.
+	store = openStore(t, dir)
+	store.Close()
+}
+
+func TestActorReplayed(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	doSimpleCommands(t, store)
+	err := store.Do(&Command{Op: OpGrantAdmin, Email: "fred.bloggs"})
+	testutil.AssertNilErr(t, err, "Grant first admin")
+	err = store.Do(&Command{Op: OpRemoveSkill, Actor: "fred.bloggs",
+		SkillId: 1})
+	testutil.AssertErrGenerated(t, err, model.CannotRemoveRootSkill,
+		"Remove as admin")
+	err = store.Do(&Command{Op: OpRevokeAdmin, Actor: "john.smith",
+		Email: "fred.bloggs"})
+	testutil.AssertErrGenerated(t, err, model.PermissionDenied,
+		"Revoke without actor being admin")
+	store.Close()
+
+	store = openStore(t, dir)
+	defer store.Close()
+	testutil.AssertTrue(t, store.api.IsAdmin("fred.bloggs"), "Admin replayed")
+}
+
+func TestNotificationsDelivered(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	recorder := &recordingNotifier{}
+	store.Notifier = recorder
+	doSimpleCommands(t, store)
+	store.Do(&Command{Op: OpAddPerson, Email: "john.smith"})
+	store.Do(&Command{Op: OpSetSkillTitle, Actor: "john.smith", SkillId: 2,
+		Title: "Renamed"})
+	store.Close()
+	testutil.AssertEqInt(t, len(recorder.received), 1, "Delivered")
+	testutil.AssertEqString(t, recorder.received[0].Change, model.Renamed,
+		"Delivered")
+
+	// Replaying the journal must not deliver them again.
+	store, _ = NewStore(dir)
+	store.Notifier = recorder
+	err := store.Open()
+	testutil.AssertNilErr(t, err, "Open")
+	store.Close()
+	testutil.AssertEqInt(t, len(recorder.received), 1, "Not redelivered")
+}
+
+func TestCompaction(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	store.CompactEvery = 2
+	doSimpleCommands(t, store)
+	testutil.AssertEqInt(t, store.generation, 2, "Generation")
+	err := store.Do(&Command{Op: OpCollapseSkill, Email: "fred.bloggs",
+		SkillId: 1})
+	testutil.AssertNilErr(t, err, "Collapse")
+	store.Close()
+
+	// Only the current and last-good generations should be kept.
+	_, err = os.Stat(store.snapshotFile(0))
+	testutil.AssertTrue(t, os.IsNotExist(err), "Old generation removed")
+	_, err = os.Stat(store.LastGoodFile())
+	testutil.AssertNilErr(t, err, "Last good generation kept")
+
+	// Re-opening should load the snapshot and replay the collapse.
+	store = openStore(t, dir)
+	defer store.Close()
+	checkSimpleCommands(t, store.api)
+	collapsed, _ := store.api.IsCollapsed("fred.bloggs", 1)
+	testutil.AssertTrue(t, collapsed, "Replay after snapshot")
+}
+
+func TestIncompleteJournalLineIgnored(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	doSimpleCommands(t, store)
+	store.Close()
+
+	// Simulate a crash part way through appending a command.
+	file, _ := os.OpenFile(store.journalFile(0), os.O_APPEND|os.O_WRONLY, 0)
+	file.WriteString(`{"op":"AddPers`)
+	file.Close()
+
+	store = openStore(t, dir)
+	err := store.Do(&Command{Op: OpAddPerson, Email: "john.smith"})
+	testutil.AssertNilErr(t, err, "Append after incomplete line")
+	store.Close()
+	store = openStore(t, dir)
+	defer store.Close()
+	checkSimpleCommands(t, store.api)
+	testutil.AssertTrue(t, store.api.PersonExists("john.smith"),
+		"Append after incomplete line")
+}
+
+func TestCorruptSnapshotRefused(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	doSimpleCommands(t, store)
+	store.Save()
+	store.Save()
+	store.Close()
+	lastGoodBefore, _ := os.ReadFile(store.LastGoodFile())
+
+	err := os.WriteFile(store.snapshotFile(store.generation),
+		[]byte("skills: [[[ garbage"), 0600)
+	testutil.AssertNilErr(t, err, "Corrupting snapshot")
+	store, _ = NewStore(dir)
+	err = store.Open()
+	testutil.AssertErrGenerated(t, err, CorruptDataFile, "Corrupt snapshot")
+	testutil.AssertStrContains(t, err.Error(), store.LastGoodFile(),
+		"Corrupt snapshot")
+
+	// The last-good copy must have survived intact.
+	lastGoodAfter, _ := os.ReadFile(store.LastGoodFile())
+	testutil.AssertEqString(t, string(lastGoodAfter), string(lastGoodBefore),
+		"Last good copy")
+}
+
+func TestRepairSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	doSimpleCommands(t, store)
+	store.Save()
+	store.Close()
+
+	path := store.snapshotFile(store.generation)
+	content, _ := os.ReadFile(path)
+	content = []byte(strings.Replace(string(content), "nextskill: 3",
+		"nextskill: 1", 1))
+	os.WriteFile(path, content, 0600)
+	store = openStore(t, dir)
+	problems, err := store.Verify(false)
+	testutil.AssertNilErr(t, err, "Verify")
+	testutil.AssertEqInt(t, len(problems), 1, "Problem found")
+	problems, err = store.Verify(true)
+	testutil.AssertNilErr(t, err, "Repair")
+	testutil.AssertEqInt(t, len(problems), 1, "Problem repaired")
+	store.Close()
+
+	// The repair must have been saved.
+	store = openStore(t, dir)
+	defer store.Close()
+	problems, _ = store.Verify(false)
+	testutil.AssertEqInt(t, len(problems), 0, "Repair saved")
+	checkSimpleCommands(t, store.api)
+}
+
+func TestCorruptJournalRefused(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	doSimpleCommands(t, store)
+	store.Close()
+
+	content, _ := os.ReadFile(store.journalFile(0))
+	content = []byte(strings.Replace(string(content), `"newuid":2`,
+		`"newuid":7`, 1))
+	os.WriteFile(store.journalFile(0), content, 0600)
+	store, _ = NewStore(dir)
+	err := store.Open()
+	testutil.AssertErrGenerated(t, err, ReplayDiverged, "Corrupt journal")
+}
+
+func TestUndoReplayed(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	doSimpleCommands(t, store)
+	commands := []*Command{
+		{Op: OpSetSkillDesc, Actor: "fred.bloggs", SkillId: 2, Desc: "One"},
+		{Op: OpSetSkillDesc, Actor: "fred.bloggs", SkillId: 2, Desc: "Two"},
+		{Op: OpUndo, Actor: "fred.bloggs"},
+		{Op: OpUndo, Actor: "fred.bloggs"},
+		{Op: OpRedo, Actor: "fred.bloggs"},
+	}
+	for _, cmd := range commands {
+		err := store.Do(cmd)
+		testutil.AssertNilErr(t, err, "Command "+cmd.Op)
+	}
+	store.Close()
+
+	// The replayed commands must rebuild the same history.
+	store = openStore(t, dir)
+	defer store.Close()
+	_, desc, _, _, _ := store.api.SkillWording(2)
+	testutil.AssertEqString(t, desc, "One", "Undo replayed")
+	_, redo, _, _ := store.api.UndoState("fred.bloggs")
+	testutil.AssertEqString(t, redo, "description change of Skill",
+		"History replayed")
+
+	// A snapshot begins a new history.
+	store.Save()
+	err := store.Do(&Command{Op: OpRedo, Actor: "fred.bloggs"})
+	testutil.AssertErrGenerated(t, err, model.NothingToRedo,
+		"History forgotten")
+}
+
+func TestFailedCommandKeepsUndoHistory(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	doSimpleCommands(t, store)
+	commands := []*Command{
+		{Op: OpGrantAdmin, Email: "fred.bloggs"},
+		{Op: OpSetSkillDesc, Actor: "fred.bloggs", SkillId: 2, Desc: "One"},
+		{Op: OpSetSkillDesc, Actor: "fred.bloggs", SkillId: 1, Desc: "Two"},
+		{Op: OpSetSkillRole, Actor: "fred.bloggs", SkillId: 1,
+			Role: model.Skill},
+		{Op: OpUndo, Actor: "fred.bloggs"},
+	}
+	for _, cmd := range commands {
+		store.Do(cmd)
+	}
+	check := func(api *model.Api, label string) {
+		_, desc, _, _, _ := api.SkillWording(1)
+		testutil.AssertEqString(t, desc, "Root desc", label)
+		_, desc, _, _, _ = api.SkillWording(2)
+		testutil.AssertEqString(t, desc, "One", label)
+	}
+	// The failed role change must not have dropped the last edit, since it
+	// is not journaled, and so the replayed Undo would undo another edit.
+	check(store.api, "Undo after failed command")
+	store.Close()
+	store = openStore(t, dir)
+	defer store.Close()
+	check(store.api, "Undo after failed command replayed")
+}
+
+func TestCommandsAudited(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	store.Audit, _ = audit.NewLog(filepath.Join(dir, "audit"))
+	doSimpleCommands(t, store)
+	store.Do(&Command{Op: OpRemoveSkill, Actor: "fred.bloggs", SkillId: 2})
+	store.Do(&Command{Op: OpSplitSkill, Actor: "fred.bloggs", SkillId: 1})
+	err := store.Restore("fred.bloggs", []byte{})
+	testutil.AssertErrGenerated(t, err, model.PermissionDenied, "Restore")
+	store.Close()
+
+	// Replaying the journal must not audit the commands again.
+	store, _ = NewStore(dir)
+	store.Audit, _ = audit.NewLog(filepath.Join(dir, "audit"))
+	err = store.Open()
+	testutil.AssertNilErr(t, err, "Open")
+	defer store.Close()
+	entries, err := store.Audit.Query(audit.Filter{})
+	testutil.AssertNilErr(t, err, "Query")
+	testutil.AssertEqInt(t, len(entries), 7, "Entries")
+	testutil.AssertEqString(t, entries[0].Actor, "fred.bloggs",
+		"Actor of self-service command")
+	testutil.AssertEqInt(t, len(entries[2].Skills), 2, "New skill and parent")
+	testutil.AssertEqString(t, entries[4].Error,
+		model.PermissionDenied, "Outcome")
+	testutil.AssertStrContains(t, string(entries[4].Args), `"skill":2`,
+		"Arguments")
+	testutil.AssertEqString(t, entries[6].Op, RestoreOp, "Restore audited")
+	entries, _ = store.Audit.Query(audit.Filter{SkillId: 2})
+	testutil.AssertEqInt(t, len(entries), 3, "Entries for skill")
+
+	// People are recorded by name, however their addresses are typed.
+	store.Do(&Command{Op: OpRemovePersonSkill, Email: "Fred.Bloggs@corp.com",
+		SkillId: 2})
+	entries, _ = store.Audit.Query(audit.Filter{Person: "fred.bloggs"})
+	testutil.AssertEqString(t, entries[len(entries)-1].Person, "fred.bloggs",
+		"Person normalised")
+}
+
+func TestAuditFailureStillJournaled(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	auditDir := filepath.Join(dir, "audit")
+	store.Audit, _ = audit.NewLog(auditDir)
+	os.RemoveAll(auditDir)
+	os.WriteFile(auditDir, []byte{}, 0600)
+	err := store.Do(&Command{Op: OpAddPerson, Email: "fred.bloggs"})
+	testutil.AssertTrue(t, err != nil, "Audit fails")
+	store.Close()
+
+	// The command has been applied and journaled, despite the audit failing.
+	store = openStore(t, dir)
+	defer store.Close()
+	testutil.AssertTrue(t, store.api.PersonExists("fred.bloggs"),
+		"Command journaled")
+}
+
+func TestJournalIndependentOfIdentityPolicy(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	policy := model.NewIdentityPolicy("acme.com")
+	policy.AddAlias("fbloggs", "fred.bloggs")
+	store.api.SetIdentityPolicy(policy)
+	err := store.Do(&Command{Op: OpAddPerson, Email: "Fred.Bloggs@ACME.com"})
+	testutil.AssertNilErr(t, err, "Add person")
+	err = store.Do(&Command{Op: OpGrantAdmin, Email: "fbloggs@acme.com"})
+	testutil.AssertNilErr(t, err, "Grant admin by alias")
+	store.Close()
+
+	// Replayed with a different policy, the journal gives the same people.
+	store, _ = NewStore(dir)
+	store.Configure = func(api *model.Api) {
+		api.SetIdentityPolicy(model.NewIdentityPolicy("other.com"))
+	}
+	err = store.Open()
+	testutil.AssertNilErr(t, err, "Replay with other policy")
+	defer store.Close()
+	testutil.AssertTrue(t, store.api.IsAdmin("fred.bloggs"), "Admin replayed")
+}
+
+func TestJournalFailureRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	defer store.Close()
+	doSimpleCommands(t, store)
+	store.journal.file.Close()
+	err := store.Do(&Command{Op: OpAddPerson, Email: "john.smith"})
+	testutil.AssertTrue(t, err != nil, "Journal fails")
+	testutil.AssertFalse(t, store.api.PersonExists("john.smith"),
+		"Model unchanged")
+	checkSimpleCommands(t, store.api)
+
+	// The journal has been reopened, so the next command is recorded.
+	err = store.Do(&Command{Op: OpAddPerson, Email: "john.smith"})
+	testutil.AssertNilErr(t, err, "Command after rollback")
+	testutil.AssertEqInt(t, store.journal.count, 5, "Journaled commands")
+}
+
+func TestFailedStoreRefusesCommands(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+	doSimpleCommands(t, store)
+	store.journal.file.Close()
+	os.WriteFile(store.journalFile(0), []byte("garbage\n"), 0600)
+	err := store.Do(&Command{Op: OpAddPerson, Email: "john.smith"})
+	testutil.AssertTrue(t, err != nil, "Journal fails")
+	err = store.Do(&Command{Op: OpAddPerson, Email: "jane.doe"})
+	testutil.AssertErrGenerated(t, err, StoreFailed, "Failed store")
+	err = store.Save()
+	testutil.AssertErrGenerated(t, err, StoreFailed, "Save failed store")
+}
+
+//-----------------------------------------------------------------------------
+// Helper functions
+//-----------------------------------------------------------------------------
+
+func openStore(t *testing.T, dir string) *Store {
+	store, err := NewStore(dir)
+	testutil.AssertNilErr(t, err, "New store")
+	err = store.Open()
+	testutil.AssertNilErr(t, err, "Open store")
+	return store
+}
+
+func doSimpleCommands(t *testing.T, store *Store) {
+	commands := []*Command{
+		{Op: OpAddPerson, Email: "fred.bloggs"},
+		{Op: OpAddSkill, Actor: "fred.bloggs", Role: model.Category,
+			Title: "Root", Desc: "Root desc", Parent: -1},
+		{Op: OpAddSkill, Actor: "fred.bloggs", Role: model.Skill,
+			Title: "Skill", Desc: "Skill desc", Parent: 1},
+		{Op: OpGivePersonSkill, Email: "fred.bloggs", SkillId: 2},
+	}
+	for _, cmd := range commands {
+		err := store.Do(cmd)
+		testutil.AssertNilErr(t, err, "Command "+cmd.Op)
+	}
+}
+
+func checkSimpleCommands(t *testing.T, api *model.Api) {
+	testutil.AssertTrue(t, api.PersonExists("fred.bloggs"), "Person")
+	hasSkill, err := api.PersonHasSkill("fred.bloggs", 2)
+	testutil.AssertNilErr(t, err, "Person has skill")
+	testutil.AssertTrue(t, hasSkill, "Person has skill")
+}
+
+// The recordingNotifier type is a notify.Notifier that remembers what it is
+// given.
+type recordingNotifier struct {
+	received []model.Notification
+}
+
+func (recorder *recordingNotifier) Notify(
+	notification model.Notification) error {
+	recorder.received = append(recorder.received, notification)
+	return nil
+}
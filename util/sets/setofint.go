@@ -1,11 +1,18 @@
 /*
 The package sets, provides types to model a set of integers, a set of strings
 etc. In addition to the core operations of adding members and testing for the
-presence of a given member, the sets implement the yaml package's Marshaler and
-UnMarshaller interfaces - so that sets may conveniently be serialized.
+presence of a given member, the sets implement the Marshaler and UnMarshaller
+interfaces of both the yaml and the encoding/json packages - so that sets may
+conveniently be serialized. Sets are serialized as lists in sorted order, so
+that the same set is always serialized the same way.
 */
 package sets
 
+import (
+	"encoding/json"
+	"sort"
+)
+
 // The SetOfInt type provides the conventional SET model for integers.
 type SetOfInt struct {
 	data map[int]bool
@@ -62,7 +69,7 @@ func (s *SetOfInt) Contains(val int) bool {
 }
 
 func (s *SetOfInt) MarshalYAML() (interface{}, error) {
-	return s.AsSlice(), nil
+	return s.sorted(), nil
 }
 
 func (s *SetOfInt) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -72,6 +79,25 @@ func (s *SetOfInt) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return err
 }
 
+func (s *SetOfInt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.sorted())
+}
+
+func (s *SetOfInt) UnmarshalJSON(in []byte) error {
+	tmpSlice := make([]int, 0)
+	err := json.Unmarshal(in, &tmpSlice)
+	s.Overwrite(tmpSlice)
+	return err
+}
+
+// The function sorted() provides the members of the set in order, so that
+// the set is always serialized the same way.
+func (set *SetOfInt) sorted() (slice []int) {
+	slice = append([]int{}, set.AsSlice()...)
+	sort.Ints(slice)
+	return slice
+}
+
 // The function AsSlice() provides a slice of integers comprising the
 // members of the set.
 func (set *SetOfInt) AsSlice() (slice []int) {
@@ -1,6 +1,7 @@
 package sets
 
 import (
+	"encoding/json"
 	"github.com/peterhoward42/skilldrill/util/testutil"
 	"testing"
 )
@@ -63,4 +64,17 @@ func TestSetOfInt(t *testing.T) {
 	set.TogglePresenceOf(999)
 	testutil.AssertEqInt(t, len(set.AsSlice()), 4, "Toggle presence of.")
 	testutil.AssertTrue(t, set.Contains(999), "Toggle presence of.")
+
+	// Check JSON round trip, which is sorted
+	set = NewSetOfInt()
+	set.Add(3)
+	set.Add(1)
+	out, err := json.Marshal(set)
+	testutil.AssertNilErr(t, err, "Marshal JSON.")
+	testutil.AssertEqString(t, string(out), "[1,3]", "Marshal JSON.")
+	set = NewSetOfInt()
+	err = json.Unmarshal(out, set)
+	testutil.AssertNilErr(t, err, "Unmarshal JSON.")
+	testutil.AssertEqInt(t, len(set.AsSlice()), 2, "Unmarshal JSON.")
+	testutil.AssertTrue(t, set.Contains(3), "Unmarshal JSON.")
 }
@@ -1,5 +1,10 @@
 package sets
 
+import (
+	"encoding/json"
+	"sort"
+)
+
 // The SetOfString type provides the conventional SET model for strings.
 type SetOfString struct {
 	data map[string]bool
@@ -56,7 +61,7 @@ func (set *SetOfString) Contains(str string) bool {
 }
 
 func (s *SetOfString) MarshalYAML() (interface{}, error) {
-	return s.AsSlice(), nil
+	return s.sorted(), nil
 }
 
 func (s *SetOfString) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -66,6 +71,25 @@ func (s *SetOfString) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return err
 }
 
+func (s *SetOfString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.sorted())
+}
+
+func (s *SetOfString) UnmarshalJSON(in []byte) error {
+	tmpSlice := make([]string, 0)
+	err := json.Unmarshal(in, &tmpSlice)
+	s.Overwrite(tmpSlice)
+	return err
+}
+
+// The function sorted() provides the members of the set in order, so that
+// the set is always serialized the same way.
+func (set *SetOfString) sorted() (slice []string) {
+	slice = append([]string{}, set.AsSlice()...)
+	sort.Strings(slice)
+	return slice
+}
+
 func (set *SetOfString) AsSlice() (slice []string) {
 	for k, _ := range set.data {
 		slice = append(slice, k)
@@ -1,6 +1,7 @@
 package sets
 
 import (
+	"encoding/json"
 	"github.com/peterhoward42/skilldrill/util/testutil"
 	"testing"
 )
@@ -63,4 +64,17 @@ func TestSetOfString(t *testing.T) {
 	set.TogglePresenceOf("wontbethere")
 	testutil.AssertEqInt(t, len(set.AsSlice()), 4, "Toggle presence of.")
 	testutil.AssertTrue(t, set.Contains("wontbethere"), "Toggle presence of.")
+
+	// Check JSON round trip, which is sorted
+	set = NewSetOfString()
+	set.Add("B")
+	set.Add("A")
+	out, err := json.Marshal(set)
+	testutil.AssertNilErr(t, err, "Marshal JSON.")
+	testutil.AssertEqString(t, string(out), `["A","B"]`, "Marshal JSON.")
+	set = NewSetOfString()
+	err = json.Unmarshal(out, set)
+	testutil.AssertNilErr(t, err, "Unmarshal JSON.")
+	testutil.AssertEqInt(t, len(set.AsSlice()), 2, "Unmarshal JSON.")
+	testutil.AssertTrue(t, set.Contains("B"), "Unmarshal JSON.")
 }